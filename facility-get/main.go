@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"log"
 	"os"
 	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/goccy/go-json"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/httpcache"
+	"github.com/tsuvic/ca-geo-corona/internal/page"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+	"github.com/tsuvic/ca-geo-corona/internal/render"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
+// キャッシュの有効期限を日本時間で判定する
+var clk clock.Clock = clock.System{}
+
 // https://bmcgeriatr.biomedcentral.com/articles/10.1186/s12877-019-1160-9
 type Facility struct {
 	Id              string `json:"id" db:"id"`
@@ -48,37 +54,66 @@ var (
 	DBPASS            = os.Getenv("DBPASS")
 )
 
-func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// 一覧のソート順（id、都道府県・id順、報告日・id順）
+var sorts = []page.Sort{
+	{Name: "id", Columns: []string{"id"}},
+	{Name: "prefName", Columns: []string{"pref_name", "id"}},
+	{Name: "submitDate", Columns: []string{"submit_date", "id"}},
+}
+
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	p, err := page.Parse(sorts, request.QueryStringParameters["sort"], request.QueryStringParameters["limit"], request.QueryStringParameters["cursor"])
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, problem.BadRequest("%w", err)
+	}
+
+	//出力形式の指定誤りはDB接続前に返却する
+	if _, err := render.FromRequest(request); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
 	db, err := sql.Open("mysql", "")
 	if err != nil {
-		panic(err)
+		return events.APIGatewayProxyResponse{}, problem.Database(err)
 	}
 	defer db.Close()
 
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err != nil {
-		panic(err)
+		return events.APIGatewayProxyResponse{}, problem.Database(err)
 	}
 
 	var whereClauses []string
+	var args []interface{}
 	queryPrefName := request.MultiValueQueryStringParameters["prefName"]
 	for _, val := range queryPrefName {
-		whereClauses = append(whereClauses, fmt.Sprintf("pref_name = '%s'", val))
+		whereClauses = append(whereClauses, "pref_name = ?")
+		args = append(args, val)
 	}
 	queryCityName := request.MultiValueQueryStringParameters["cityName"]
 	for _, val := range queryCityName {
-		whereClauses = append(whereClauses, fmt.Sprintf("city_name = '%s'", val))
+		whereClauses = append(whereClauses, "city_name = ?")
+		args = append(args, val)
 	}
 
-	var whereClause string
+	var conditions []string
 	if len(whereClauses) > 0 {
-		whereClause = " WHERE " + strings.Join(whereClauses, " OR ")
+		conditions = append(conditions, "("+strings.Join(whereClauses, " OR ")+")")
+	}
+	if pageClause, pageArgs := p.Where(); pageClause != "" {
+		conditions = append(conditions, pageClause)
+		args = append(args, pageArgs...)
+	}
+	var whereClause string
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	rows, err := db.Query("SELECT * FROM facility" + whereClause)
+	rows, err := db.QueryContext(ctx, "SELECT * FROM facility"+whereClause+p.OrderBy(), args...)
 	if err != nil {
-		panic(err)
+		return events.APIGatewayProxyResponse{}, err
 	}
+	defer rows.Close()
 
 	facilityList := make([]Facility, 0)
 	for rows.Next() {
@@ -103,26 +138,38 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 			&facility.CreatedAt,
 			&facility.UpdatedAt)
 		if err != nil {
-			log.Fatal(err)
+			return events.APIGatewayProxyResponse{}, err
 		}
 		facilityList = append(facilityList, facility)
 	}
 	if err = rows.Err(); err != nil {
-		panic(err)
+		return events.APIGatewayProxyResponse{}, err
 	}
 
-	jsonBytes, err := json.Marshal(facilityList)
-	if err != nil {
-		panic(err)
+	//1行多く取得できた場合は次ページあり
+	var next string
+	if len(facilityList) > p.Limit {
+		facilityList = facilityList[:p.Limit]
+		last := facilityList[len(facilityList)-1]
+		keys := map[string]string{"id": last.Id, "pref_name": last.PrefName, "submit_date": last.SubmitDate}
+		cursorKeys := make([]string, len(p.Sort.Columns))
+		for i, column := range p.Sort.Columns {
+			cursorKeys[i] = keys[column]
+		}
+		next = p.Next(cursorKeys)
 	}
-	fmt.Printf("Body Size : %d Byte \n", len(jsonBytes))
 
-	return events.APIGatewayProxyResponse{
-		Body:       string(jsonBytes),
-		StatusCode: 200,
-	}, nil
+	res, err := render.Respond(request, facilityList, facilityList)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if next != "" {
+		res.Headers["Link"] = page.Link(request.Path, page.RequestQuery(request), next)
+	}
+	//次回の取込までキャッシュさせる
+	return httpcache.Apply(request, res, clk.Now()), nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(problem.Wrap(handler))
 }
@@ -1,21 +1,77 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
 )
 
 func TestHandler(t *testing.T) {
+	handler := problem.Wrap(handler)
+	ctx := context.Background()
+
+	t.Run("Invalid sort", func(t *testing.T) {
+		res, err := handler(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"sort": "facilityName"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 400 {
+			t.Fatalf("StatusCode = %d, want 400", res.StatusCode)
+		}
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		res, err := handler(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"format": "xlsx"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 400 {
+			t.Fatalf("StatusCode = %d, want 400", res.StatusCode)
+		}
+	})
+
+	t.Run("Invalid bom", func(t *testing.T) {
+		res, err := handler(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"format": "csv", "bom": "yes"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 400 {
+			t.Fatalf("StatusCode = %d, want 400", res.StatusCode)
+		}
+	})
+
+	t.Run("Not acceptable", func(t *testing.T) {
+		res, err := handler(ctx, events.APIGatewayProxyRequest{
+			MultiValueHeaders: map[string][]string{"Accept": {"text/html"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 406 {
+			t.Fatalf("StatusCode = %d, want 406", res.StatusCode)
+		}
+	})
+
 	t.Run("Unable to get IP", func(t *testing.T) {
 		Url = "http://127.0.0.1:12345"
 
-		_, err := handler(events.APIGatewayProxyRequest{})
-		if err == nil {
-			t.Fatal("Error failed to trigger with an invalid request")
+		res, err := handler(ctx, events.APIGatewayProxyRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 503 {
+			t.Fatalf("StatusCode = %d, want 503", res.StatusCode)
 		}
 	})
 
@@ -27,9 +83,12 @@ func TestHandler(t *testing.T) {
 
 		Url = ts.URL
 
-		_, err := handler(events.APIGatewayProxyRequest{})
-		if err != nil && err.Error() != ErrNon200Response.Error() {
-			t.Fatalf("Error failed to trigger with an invalid HTTP response: %v", err)
+		res, err := handler(ctx, events.APIGatewayProxyRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode == 200 {
+			t.Fatal("Error failed to trigger with an invalid HTTP response")
 		}
 	})
 
@@ -41,8 +100,11 @@ func TestHandler(t *testing.T) {
 
 		Url = ts.URL
 
-		_, err := handler(events.APIGatewayProxyRequest{})
-		if err == nil {
+		res, err := handler(ctx, events.APIGatewayProxyRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode == 200 {
 			t.Fatal("Error failed to trigger with an invalid HTTP response")
 		}
 	})
@@ -57,8 +119,8 @@ func TestHandler(t *testing.T) {
 		// Url = ts.URL
 		Url = "https://opendata.corona.go.jp/api/covid19DailySurvey?localGovCode=012025"
 
-		_, err := handler(events.APIGatewayProxyRequest{})
-		if err != nil {
+		res, err := handler(ctx, events.APIGatewayProxyRequest{})
+		if err != nil || res.StatusCode != 200 {
 			t.Fatal("Everything should be ok")
 		}
 	})
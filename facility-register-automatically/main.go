@@ -1,17 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
 	"os"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/tsuvic/ca-geo-corona/internal/archive"
+	"github.com/tsuvic/ca-geo-corona/internal/dbutil"
+	"github.com/tsuvic/ca-geo-corona/internal/opendata"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -39,9 +40,9 @@ type Facility struct {
 }
 
 var (
-	ErrNon200Response = errors.New("non 200 Response found")
-	ErrNoJsonResponse = errors.New("no JsonResponse in HTTP response")
-	Url               = "https://opendata.corona.go.jp/api/covid19DailySurvey"
+	ErrNon200Response = opendata.ErrNon200Response
+	ErrNoJsonResponse = opendata.ErrNoJsonResponse
+	Url               = opendata.Covid19DailySurveyURL
 	ENV               = os.Getenv("ENV")
 	DBHOST            = os.Getenv("DBHOST")
 	DBNAME            = os.Getenv("DBNAME")
@@ -49,34 +50,51 @@ var (
 	DBPASS            = os.Getenv("DBPASS")
 )
 
-func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	now := time.Now()
 
-	res, err := http.Get(Url)
+	opts := opendata.OptionsFromEnv()
+	opts.Covid19DailySurveyURL = Url
+	store, err := archive.FromEnv(ctx)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	if res.StatusCode != 200 {
-		return events.APIGatewayProxyResponse{}, ErrNon200Response
-	}
-
-	JsonResponse, err := io.ReadAll(res.Body)
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
-	}
-	if len(JsonResponse) == 0 {
-		return events.APIGatewayProxyResponse{}, ErrNoJsonResponse
+	if store != nil {
+		opts.Transport = archive.Transport(store, os.Getenv("REPLAY") == "true")
 	}
+	client := opendata.NewClient(opts)
 
 	/*
 		APIから取得したJsonのデコード
 		Sliceを用いた重複削除処理
 		https://qiita.com/Sekky0905/items/ba2215981693b36e9982
 	*/
-	var FacilityList []Facility
-	err = json.Unmarshal(JsonResponse, &FacilityList)
+	items, err := client.Covid19DailySurvey(ctx, nil)
+	if errors.Is(err, opendata.ErrNon200Response) {
+		return events.APIGatewayProxyResponse{}, problem.Upstream(ErrNon200Response)
+	}
 	if err != nil {
-		log.Fatal(err)
+		return events.APIGatewayProxyResponse{}, problem.Upstream(err)
+	}
+
+	FacilityList := make([]Facility, 0, len(items))
+	for _, item := range items {
+		FacilityList = append(FacilityList, Facility{
+			FacilityId:   item.FacilityId,
+			FacilityName: item.FacilityName,
+			ZipCode:      item.ZipCode,
+			PrefName:     item.PrefName,
+			FacilityAddr: item.FacilityAddr,
+			FacilityTel:  item.FacilityTel,
+			Latitude:     item.Latitude,
+			Longitude:    item.Longitude,
+			SubmitDate:   item.SubmitDate,
+			LocalGovCode: item.LocalGovCode,
+			CityName:     item.CityName,
+			FacilityCode: item.FacilityCode,
+			FacilityType: item.FacilityType,
+			AnsType:      item.AnsType,
+		})
 	}
 
 	FacilitiyInfoMap := make(map[string]Facility)
@@ -100,33 +118,33 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 				val.Emergency = el.AnsType
 				FacilitiyInfoMap[el.FacilityId] = val
 			} else {
-				log.Fatalf("no mapping facility type")
+				return events.APIGatewayProxyResponse{}, fmt.Errorf("no mapping facility type: %s", el.FacilityType)
 			}
 		}
 	}
 
 	db, err := sql.Open("mysql", "")
 	if err != nil {
-		log.Fatal(err)
+		return events.APIGatewayProxyResponse{}, problem.Database(err)
 	}
 	defer db.Close()
 
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return events.APIGatewayProxyResponse{}, problem.Database(err)
 	}
 
-	insert, err := db.Prepare(fmt.Sprintf("INSERT INTO %s (facility_id, facility_name, zipcode, pref_name, facility_addr, facility_tel, latitude, longitude, submit_date, local_gov_code, city_name, facility_code, hospitalization, outpatient, emergency) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", "facility"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer insert.Close()
-
+	//医療機関の登録は1トランザクションで行い、途中で失敗した場合は全件ロールバックする
+	rows := make([][]interface{}, 0, len(FacilitiyInfoMap))
 	for _, val := range FacilitiyInfoMap {
-		_, err = insert.Exec(val.FacilityId, val.FacilityName, val.ZipCode, val.PrefName, val.FacilityAddr, val.FacilityTel, val.Latitude, val.Longitude, val.SubmitDate, val.LocalGovCode, val.CityName, val.FacilityCode, val.Hospitalization, val.Outpatient, val.Emergency)
-		if err != nil {
-			log.Fatal(err)
-		}
+		rows = append(rows, []interface{}{val.FacilityId, val.FacilityName, val.ZipCode, val.PrefName, val.FacilityAddr, val.FacilityTel, val.Latitude, val.Longitude, val.SubmitDate, val.LocalGovCode, val.CityName, val.FacilityCode, val.Hospitalization, val.Outpatient, val.Emergency})
+	}
+	err = dbutil.WithTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := dbutil.BulkInsert(ctx, tx, "INSERT INTO facility (facility_id, facility_name, zipcode, pref_name, facility_addr, facility_tel, latitude, longitude, submit_date, local_gov_code, city_name, facility_code, hospitalization, outpatient, emergency)", "", rows, dbutil.DefaultChunkSize)
+		return err
+	})
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
 	}
 
 	// fmt.Printf("\nFacilitiyInfo %#v\n", FacilitiyInfoMap)
@@ -138,5 +156,5 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(problem.Wrap(handler))
 }
@@ -1,22 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
 )
 
 func TestHandler(t *testing.T) {
 	t.Run("Unable to get IP", func(t *testing.T) {
 		Url = "http://127.0.0.1:12345"
 
-		_, err := handler(events.APIGatewayProxyRequest{})
+		_, err := handler(context.Background(), events.APIGatewayProxyRequest{})
 		if err == nil {
 			t.Fatal("Error failed to trigger with an invalid request")
 		}
+		if status := problem.Status(err); status != 502 {
+			t.Fatalf("Status = %d, want 502", status)
+		}
 	})
 
 	t.Run("Non 200 Response", func(t *testing.T) {
@@ -27,7 +32,7 @@ func TestHandler(t *testing.T) {
 
 		Url = ts.URL
 
-		_, err := handler(events.APIGatewayProxyRequest{})
+		_, err := handler(context.Background(), events.APIGatewayProxyRequest{})
 		if err != nil && err.Error() != ErrNon200Response.Error() {
 			t.Fatalf("Error failed to trigger with an invalid HTTP response: %v", err)
 		}
@@ -41,7 +46,7 @@ func TestHandler(t *testing.T) {
 
 		Url = ts.URL
 
-		_, err := handler(events.APIGatewayProxyRequest{})
+		_, err := handler(context.Background(), events.APIGatewayProxyRequest{})
 		if err == nil {
 			t.Fatal("Error failed to trigger with an invalid HTTP response")
 		}
@@ -57,7 +62,7 @@ func TestHandler(t *testing.T) {
 		// Url = ts.URL
 		Url = "https://opendata.corona.go.jp/api/covid19DailySurvey?localGovCode=012025"
 
-		_, err := handler(events.APIGatewayProxyRequest{})
+		_, err := handler(context.Background(), events.APIGatewayProxyRequest{})
 		if err != nil {
 			t.Fatal("Everything should be ok")
 		}
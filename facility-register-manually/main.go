@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/tsuvic/ca-geo-corona/internal/dbutil"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -39,7 +41,7 @@ var (
 	ErrNoJsonResponse = errors.New("no JsonResponse in HTTP response")
 )
 
-func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	// var cmd = exec.Command("ls", "-la")
 	// var result, _ = cmd.Output()
 	// fmt.Println(os.Getwd())
@@ -53,8 +55,7 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 		// if err, ok := err.(*json.SyntaxError); ok {
 		// 	fmt.Println(string([]byte(request.Body)[err.Offset-15 : err.Offset+15]))
 		// }
-		fmt.Println(err)
-		log.Fatal(err)
+		return events.APIGatewayProxyResponse{}, problem.BadRequest("invalid body: %v", err)
 	}
 
 	FacilitiyInfoMap := make(map[string]Facility)
@@ -78,33 +79,33 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 				val.Emergency = el.AnsType
 				FacilitiyInfoMap[el.FacilityId] = val
 			} else {
-				log.Fatalf("no mapping facility type")
+				return events.APIGatewayProxyResponse{}, fmt.Errorf("no mapping facility type: %s", el.FacilityType)
 			}
 		}
 	}
 
 	db, err := sql.Open("mysql", "")
 	if err != nil {
-		log.Fatal(err)
+		return events.APIGatewayProxyResponse{}, problem.Database(err)
 	}
 	defer db.Close()
 
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return events.APIGatewayProxyResponse{}, problem.Database(err)
 	}
 
-	insert, err := db.Prepare(fmt.Sprintf("INSERT INTO %s (facility_id, facility_name, zipcode, pref_name, facility_addr, facility_tel, latitude, longitude, submit_date, local_gov_code, city_name, facility_code, hospitalization, outpatient, emergency) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", "facility"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer insert.Close()
-
+	//医療機関の登録は1トランザクションで行い、途中で失敗した場合は全件ロールバックする
+	rows := make([][]interface{}, 0, len(FacilitiyInfoMap))
 	for _, val := range FacilitiyInfoMap {
-		_, err = insert.Exec(val.FacilityId, val.FacilityName, val.ZipCode, val.PrefName, val.FacilityAddr, val.FacilityTel, val.Latitude, val.Longitude, val.SubmitDate, val.LocalGovCode, val.CityName, val.FacilityCode, val.Hospitalization, val.Outpatient, val.Emergency)
-		if err != nil {
-			log.Fatal(err)
-		}
+		rows = append(rows, []interface{}{val.FacilityId, val.FacilityName, val.ZipCode, val.PrefName, val.FacilityAddr, val.FacilityTel, val.Latitude, val.Longitude, val.SubmitDate, val.LocalGovCode, val.CityName, val.FacilityCode, val.Hospitalization, val.Outpatient, val.Emergency})
+	}
+	err = dbutil.WithTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := dbutil.BulkInsert(ctx, tx, "INSERT INTO facility (facility_id, facility_name, zipcode, pref_name, facility_addr, facility_tel, latitude, longitude, submit_date, local_gov_code, city_name, facility_code, hospitalization, outpatient, emergency)", "", rows, dbutil.DefaultChunkSize)
+		return err
+	})
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
 	}
 
 	// fmt.Printf("FacilitiyInfo %#v\n", FacilitiyInfoMap)
@@ -115,5 +116,5 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(problem.Wrap(handler))
 }
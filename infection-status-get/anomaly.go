@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+)
+
+// 登録時に検出した異常値の扱い
+// show（既定）: そのまま返す
+// smooth: 日次感染者数を検出時の直近の中央値に置き換える（中央値がない負の値は0）
+// annotate: 検出理由（anomaly）と直近の中央値（anomalyExpected）を付与する
+const (
+	anomalyShow     = "show"
+	anomalySmooth   = "smooth"
+	anomalyAnnotate = "annotate"
+)
+
+func parseAnomalies(req events.APIGatewayProxyRequest, groupBy string) (string, error) {
+	switch mode := req.QueryStringParameters["anomalies"]; mode {
+	case "", anomalyShow:
+		return anomalyShow, nil
+	case anomalySmooth:
+		return mode, nil
+	case anomalyAnnotate:
+		//検出は都道府県・全国の行ごとのため、地方・全国への合算には付与できない
+		if groupBy != "prefecture" {
+			return "", problem.BadRequest("anomalies=%s is not supported with groupBy=%s", mode, groupBy)
+		}
+		return mode, nil
+	default:
+		return "", problem.BadRequest("unknown anomalies: %s", mode)
+	}
+}
+
+type anomalyKey struct {
+	date       time.Time
+	prefecture string
+}
+
+type anomalyFlag struct {
+	reason               string
+	infectionNumberDaily int
+	expected             sql.NullFloat64
+}
+
+func selectAnomalies(db *sql.DB, from, to time.Time) (map[anomalyKey]anomalyFlag, error) {
+	rows, err := db.Query("SELECT date, prefecture, reason, infection_number_daily, expected FROM infection_status_anomaly WHERE date >= ? AND date <= ?", from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := make(map[anomalyKey]anomalyFlag)
+	for rows.Next() {
+		var key anomalyKey
+		var flag anomalyFlag
+		if err := rows.Scan(&key.date, &key.prefecture, &flag.reason, &flag.infectionNumberDaily, &flag.expected); err != nil {
+			return nil, err
+		}
+		flags[key] = flag
+	}
+	return flags, rows.Err()
+}
+
+// 異常値の扱いを適用する
+// 検出時と値が異なる行（asOfで過去の値を参照した場合など）は対象外とする
+func applyAnomalies(infectionStatusList []InfectionStatus, flags map[anomalyKey]anomalyFlag, mode string) {
+	for i := range infectionStatusList {
+		val := &infectionStatusList[i]
+		flag, ok := flags[anomalyKey{date: val.Date, prefecture: val.Prefecture}]
+		if !ok || flag.infectionNumberDaily != val.InfectionNumberDaily {
+			continue
+		}
+		reason := flag.reason
+		val.Anomaly = &reason
+		switch mode {
+		case anomalySmooth:
+			val.InfectionNumberDaily = 0
+			if flag.expected.Valid {
+				val.InfectionNumberDaily = int(math.Round(flag.expected.Float64))
+			}
+		case anomalyAnnotate:
+			if flag.expected.Valid {
+				expected := round2(flag.expected.Float64)
+				val.AnomalyExpected = &expected
+			}
+		}
+	}
+}
+
+// 行の期間の検出結果を取得して適用する
+func markAnomalies(db *sql.DB, infectionStatusList []InfectionStatus, mode string) error {
+	if mode == anomalyShow || len(infectionStatusList) == 0 {
+		return nil
+	}
+	from, to := dateRange(infectionStatusList)
+	flags, err := selectAnomalies(db, from, to)
+	if err != nil {
+		return err
+	}
+	applyAnomalies(infectionStatusList, flags, mode)
+	return nil
+}
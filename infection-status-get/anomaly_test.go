@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func Test_parseAnomalies(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		groupBy string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", groupBy: "prefecture", want: anomalyShow},
+		{name: "smooth region", params: map[string]string{"anomalies": "smooth"}, groupBy: "region", want: anomalySmooth},
+		{name: "annotate", params: map[string]string{"anomalies": "annotate"}, groupBy: "prefecture", want: anomalyAnnotate},
+		{name: "annotate national", params: map[string]string{"anomalies": "annotate"}, groupBy: "national", wantErr: true},
+		{name: "unknown", params: map[string]string{"anomalies": "hide"}, groupBy: "prefecture", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAnomalies(events.APIGatewayProxyRequest{QueryStringParameters: tt.params}, tt.groupBy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAnomalies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseAnomalies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applyAnomalies(t *testing.T) {
+	d := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	flags := map[anomalyKey]anomalyFlag{
+		{date: d, prefecture: "東京都"}: {reason: "outlier", infectionNumberDaily: 8000, expected: sql.NullFloat64{Float64: 1030.4, Valid: true}},
+		{date: d, prefecture: "北海道"}: {reason: "negative", infectionNumberDaily: -3},
+		//検出時と値が異なる
+		{date: d, prefecture: "大阪府"}: {reason: "outlier", infectionNumberDaily: 5000, expected: sql.NullFloat64{Float64: 500, Valid: true}},
+	}
+	rows := func() []InfectionStatus {
+		return []InfectionStatus{
+			{Date: d, Prefecture: "北海道", InfectionNumberDaily: -3},
+			{Date: d, Prefecture: "東京都", InfectionNumberDaily: 8000},
+			{Date: d, Prefecture: "大阪府", InfectionNumberDaily: 520},
+		}
+	}
+
+	t.Run("smooth", func(t *testing.T) {
+		list := rows()
+		applyAnomalies(list, flags, anomalySmooth)
+		for i, want := range []int{0, 1030, 520} {
+			if list[i].InfectionNumberDaily != want {
+				t.Errorf("%s = %d, want %d", list[i].Prefecture, list[i].InfectionNumberDaily, want)
+			}
+		}
+		if list[1].Anomaly == nil || *list[1].Anomaly != "outlier" || list[2].Anomaly != nil {
+			t.Errorf("anomaly = %v, %v", list[1].Anomaly, list[2].Anomaly)
+		}
+	})
+
+	t.Run("annotate", func(t *testing.T) {
+		list := rows()
+		applyAnomalies(list, flags, anomalyAnnotate)
+		if list[0].InfectionNumberDaily != -3 || list[0].Anomaly == nil || *list[0].Anomaly != "negative" || list[0].AnomalyExpected != nil {
+			t.Errorf("北海道 = %+v", list[0])
+		}
+		if list[1].InfectionNumberDaily != 8000 || list[1].AnomalyExpected == nil || *list[1].AnomalyExpected != 1030.4 {
+			t.Errorf("東京都 = %+v", list[1])
+		}
+		if list[2].Anomaly != nil {
+			t.Errorf("大阪府 = %+v", list[2])
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+	"github.com/tsuvic/ca-geo-corona/internal/seasonal"
+)
+
+// 移動平均の最大日数
+const maxMovingAverage = 28
+
+// 曜日別の係数の推定に使う日数
+const adjustmentHistory = 56
+
+// 派生値の指定（未指定の場合は従来のレスポンス）
+// movingAverage=N N日間の後方移動平均、sum7=true 7日間合計、per100k=true 人口10万人あたり
+// adjusted=true 曜日による変動の補正値
+type derivedOptions struct {
+	movingAverage int
+	sum7          bool
+	per100k       bool
+	adjusted      bool
+}
+
+func parseDerived(req events.APIGatewayProxyRequest) (derivedOptions, error) {
+	var opts derivedOptions
+	if val := req.QueryStringParameters["movingAverage"]; val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > maxMovingAverage {
+			return opts, problem.BadRequest("invalid movingAverage: %s (want 1-%d)", val, maxMovingAverage)
+		}
+		opts.movingAverage = n
+	}
+	for _, param := range []struct {
+		key string
+		val *bool
+	}{{"sum7", &opts.sum7}, {"per100k", &opts.per100k}, {"adjusted", &opts.adjusted}} {
+		switch val := req.QueryStringParameters[param.key]; val {
+		case "", "false":
+		case "true":
+			*param.val = true
+		default:
+			return opts, problem.BadRequest("invalid %s: %s", param.key, val)
+		}
+	}
+	return opts, nil
+}
+
+func (o derivedOptions) enabled() bool {
+	return o.movingAverage > 0 || o.sum7 || o.per100k || o.adjusted
+}
+
+// 後方の集計に必要な日数
+func (o derivedOptions) window() int {
+	window := o.movingAverage
+	if o.sum7 && window < 7 {
+		window = 7
+	}
+	if o.adjusted {
+		window = adjustmentHistory
+	}
+	return window
+}
+
+// 行の最初と最後の日付
+func dateRange(infectionStatusList []InfectionStatus) (time.Time, time.Time) {
+	from, to := infectionStatusList[0].Date, infectionStatusList[0].Date
+	for _, val := range infectionStatusList {
+		if val.Date.Before(from) {
+			from = val.Date
+		}
+		if val.Date.After(to) {
+			to = val.Date
+		}
+	}
+	return from, to
+}
+
+// 派生値の算出に必要な前日分を含む期間の行を取得する
+// anomalies=smoothの場合は前日分の異常値も置き換える
+func selectHistory(db *sql.DB, req events.APIGatewayProxyRequest, infectionStatusList []InfectionStatus, groupBy string, window int, anomalies string) ([]InfectionStatus, error) {
+	if len(infectionStatusList) == 0 || window <= 1 {
+		return infectionStatusList, nil
+	}
+	from, to := dateRange(infectionStatusList)
+
+	//日付の指定をfrom〜toに置き換え、都道府県・地方・asOfの指定はそのまま使う
+	historyReq := events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{
+			"from": from.AddDate(0, 0, 1-window).Format("20060102"),
+			"to":   to.Format("20060102"),
+			"asOf": req.QueryStringParameters["asOf"],
+		},
+		MultiValueQueryStringParameters: map[string][]string{
+			"prefecture": req.MultiValueQueryStringParameters["prefecture"],
+			"region":     req.MultiValueQueryStringParameters["region"],
+		},
+	}
+	fromClause, query, err := createFromClause(historyReq)
+	if err != nil {
+		return nil, err
+	}
+	whereClause, whereQuery, err := createWhereClause(historyReq)
+	if err != nil {
+		return nil, err
+	}
+	whereClause, whereQuery = excludeNational(historyReq, whereClause, whereQuery)
+	query = append(query, whereQuery...)
+
+	history, err := selectStatus(db, fmt.Sprintf("SELECT date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count FROM %s %s", fromClause, whereClause), query)
+	if err != nil {
+		return nil, err
+	}
+	if anomalies == anomalySmooth {
+		if err := markAnomalies(db, history, anomalies); err != nil {
+			return nil, err
+		}
+	}
+	return groupRows(history, groupBy), nil
+}
+
+// 派生値を設定する
+// 期間内に欠損日がある場合、移動平均・7日間合計は設定しない
+func addDerived(infectionStatusList, history []InfectionStatus, opts derivedOptions) {
+	daily := make(map[string]map[time.Time]int)
+	for _, val := range history {
+		if daily[val.Prefecture] == nil {
+			daily[val.Prefecture] = make(map[time.Time]int)
+		}
+		daily[val.Prefecture][val.Date] = val.InfectionNumberDaily
+	}
+
+	var factors map[string]seasonal.Factors
+	if opts.adjusted {
+		factors = weekdayFactors(history)
+	}
+
+	for i := range infectionStatusList {
+		val := &infectionStatusList[i]
+		if f, ok := factors[val.Prefecture]; ok {
+			adjusted := round2(f.Adjust(val.Date, float64(val.InfectionNumberDaily)))
+			val.InfectionNumberDailyAdjusted = &adjusted
+		}
+		if opts.movingAverage > 0 {
+			if sum, ok := trailingSum(daily[val.Prefecture], val.Date, opts.movingAverage); ok {
+				average := round2(float64(sum) / float64(opts.movingAverage))
+				val.MovingAverage = &average
+			}
+		}
+		if opts.sum7 {
+			if sum, ok := trailingSum(daily[val.Prefecture], val.Date, 7); ok {
+				val.Sum7 = &sum
+			}
+		}
+		if opts.per100k {
+			population := prefecture.Population(val.Prefecture)
+			if population == 0 {
+				continue
+			}
+			val.InfectionNumberDailyPer100k = per100k(val.InfectionNumberDaily, population)
+			val.InfectionNumberCumulativelyPer100k = per100k(val.InfectionNumberCumulatively, population)
+			if val.Sum7 != nil {
+				val.Sum7Per100k = per100k(*val.Sum7, population)
+			}
+		}
+	}
+}
+
+// 集計単位ごとの曜日別の係数（推定できない場合は含めない）
+func weekdayFactors(history []InfectionStatus) map[string]seasonal.Factors {
+	type area struct {
+		from, to time.Time
+		daily    map[time.Time]float64
+	}
+	areas := make(map[string]*area)
+	for _, val := range history {
+		a, ok := areas[val.Prefecture]
+		if !ok {
+			a = &area{from: val.Date, to: val.Date, daily: make(map[time.Time]float64)}
+			areas[val.Prefecture] = a
+		}
+		if val.Date.Before(a.from) {
+			a.from = val.Date
+		}
+		if val.Date.After(a.to) {
+			a.to = val.Date
+		}
+		a.daily[val.Date] = float64(val.InfectionNumberDaily)
+	}
+
+	factors := make(map[string]seasonal.Factors)
+	for name, a := range areas {
+		var values []float64
+		for date := a.from; !date.After(a.to); date = date.AddDate(0, 0, 1) {
+			n, ok := a.daily[date]
+			if !ok {
+				n = math.NaN()
+			}
+			values = append(values, n)
+		}
+		if f, ok := seasonal.Estimate(a.from, values); ok {
+			factors[name] = f
+		}
+	}
+	return factors
+}
+
+// dateまでのwindow日間（dateを含む）の日次感染者数の合計
+func trailingSum(daily map[time.Time]int, date time.Time, window int) (int, bool) {
+	sum := 0
+	for i := 0; i < window; i++ {
+		n, ok := daily[date.AddDate(0, 0, -i)]
+		if !ok {
+			return 0, false
+		}
+		sum += n
+	}
+	return sum, true
+}
+
+func per100k(n, population int) *float64 {
+	rate := round2(float64(n) * 100000 / float64(population))
+	return &rate
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
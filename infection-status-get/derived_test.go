@@ -0,0 +1,144 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func Test_parseDerived(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     map[string]string
+		want       derivedOptions
+		wantWindow int
+		wantErr    bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:       "movingAverage and sum7",
+			params:     map[string]string{"movingAverage": "3", "sum7": "true"},
+			want:       derivedOptions{movingAverage: 3, sum7: true},
+			wantWindow: 7,
+		},
+		{
+			name:       "per100k",
+			params:     map[string]string{"movingAverage": "14", "per100k": "true"},
+			want:       derivedOptions{movingAverage: 14, per100k: true},
+			wantWindow: 14,
+		},
+		{
+			name:       "adjusted",
+			params:     map[string]string{"adjusted": "true", "movingAverage": "7"},
+			want:       derivedOptions{movingAverage: 7, adjusted: true},
+			wantWindow: 56,
+		},
+		{
+			name:    "movingAverage out of range",
+			params:  map[string]string{"movingAverage": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid sum7",
+			params:  map[string]string{"sum7": "yes"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDerived(events.APIGatewayProxyRequest{QueryStringParameters: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDerived() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseDerived() = %+v, want %+v", got, tt.want)
+			}
+			if got.window() != tt.wantWindow {
+				t.Errorf("window() = %d, want %d", got.window(), tt.wantWindow)
+			}
+		})
+	}
+}
+
+func Test_addDerived(t *testing.T) {
+	float := func(f float64) *float64 { return &f }
+	integer := func(n int) *int { return &n }
+	day := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	//鳥取県 1/1〜1/8（1/3欠損）、東京都 1/2〜1/8
+	var history []InfectionStatus
+	for d := 1; d <= 8; d++ {
+		if d != 3 {
+			history = append(history, InfectionStatus{Date: day(d), Prefecture: "鳥取県", InfectionNumberDaily: d})
+		}
+		if d >= 2 {
+			history = append(history, InfectionStatus{Date: day(d), Prefecture: "東京都", InfectionNumberDaily: 100 * d, InfectionNumberCumulatively: 1000 * d})
+		}
+	}
+	list := []InfectionStatus{
+		{Date: day(8), Prefecture: "東京都", InfectionNumberDaily: 800, InfectionNumberCumulatively: 8000},
+		{Date: day(8), Prefecture: "鳥取県", InfectionNumberDaily: 8},
+		{Date: day(5), Prefecture: "鳥取県", InfectionNumberDaily: 5},
+	}
+	addDerived(list, history, derivedOptions{movingAverage: 2, sum7: true, per100k: true})
+
+	want := []InfectionStatus{
+		{
+			Date: day(8), Prefecture: "東京都", InfectionNumberDaily: 800, InfectionNumberCumulatively: 8000,
+			MovingAverage: float(750), Sum7: integer(3500),
+			InfectionNumberDailyPer100k: float(5.69), InfectionNumberCumulativelyPer100k: float(56.95), Sum7Per100k: float(24.92),
+		},
+		{
+			//1/3が欠損しているため7日間合計は算出しない
+			Date: day(8), Prefecture: "鳥取県", InfectionNumberDaily: 8,
+			MovingAverage:               float(7.5),
+			InfectionNumberDailyPer100k: float(1.45), InfectionNumberCumulativelyPer100k: float(0),
+		},
+		{
+			Date: day(5), Prefecture: "鳥取県", InfectionNumberDaily: 5,
+			MovingAverage:               float(4.5),
+			InfectionNumberDailyPer100k: float(0.9), InfectionNumberCumulativelyPer100k: float(0),
+		},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("addDerived() = %+v, want %+v", list, want)
+	}
+}
+
+func Test_addDerivedAdjusted(t *testing.T) {
+	//2023-01-02（月）から4週間、月曜日は他の曜日の半分
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	var history []InfectionStatus
+	for i := 0; i < 28; i++ {
+		date := start.AddDate(0, 0, i)
+		n := 130
+		if date.Weekday() == time.Monday {
+			n = 65
+		}
+		history = append(history, InfectionStatus{Date: date, Prefecture: "東京都", InfectionNumberDaily: n})
+	}
+	//鳥取県は履歴が足りない
+	history = append(history, InfectionStatus{Date: start.AddDate(0, 0, 27), Prefecture: "鳥取県", InfectionNumberDaily: 3})
+
+	list := []InfectionStatus{
+		{Date: start.AddDate(0, 0, 21), Prefecture: "東京都", InfectionNumberDaily: 65},
+		{Date: start.AddDate(0, 0, 22), Prefecture: "東京都", InfectionNumberDaily: 130},
+		{Date: start.AddDate(0, 0, 27), Prefecture: "鳥取県", InfectionNumberDaily: 3},
+	}
+	addDerived(list, history, derivedOptions{adjusted: true})
+
+	//係数は週平均（845/7）との比率で、補正値はいずれも週平均になる
+	for i, want := range []float64{120.71, 120.71} {
+		if got := list[i].InfectionNumberDailyAdjusted; got == nil || *got != want {
+			t.Errorf("list[%d] adjusted = %v, want %v", i, got, want)
+		}
+	}
+	if list[2].InfectionNumberDailyAdjusted != nil {
+		t.Errorf("鳥取県 adjusted = %v, want nil", *list[2].InfectionNumberDailyAdjusted)
+	}
+}
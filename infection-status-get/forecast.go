@@ -0,0 +1,189 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/forecast"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+	"github.com/tsuvic/ca-geo-corona/internal/render"
+)
+
+const (
+	defaultHorizon = 7
+	minHorizon     = 7
+	maxHorizon     = 14
+	defaultHistory = 56
+	maxHistory     = 365
+	// バックテストの回数
+	backtestFolds = 4
+)
+
+// horizon: 予測日数、history: 当てはめに使う日数、confidence: 予測区間の水準
+type forecastOptions struct {
+	horizon    int
+	history    int
+	confidence float64
+}
+
+type ForecastPoint struct {
+	Date                 time.Time `json:"date"`
+	InfectionNumberDaily float64   `json:"infectionNumberDaily"`
+	Lower                float64   `json:"lower"`
+	Upper                float64   `json:"upper"`
+}
+
+// 基準日以前を起点に予測した場合の誤差（MAPEは実績が0の日を除く）
+type ForecastBacktest struct {
+	Horizon  int      `json:"horizon"`
+	Folds    int      `json:"folds"`
+	MAE      float64  `json:"mae"`
+	MAPE     *float64 `json:"mape"`
+	Coverage float64  `json:"coverage"`
+}
+
+// 欠損日がある都道府県は予測しない（params、backtestはnull）
+type ForecastSeries struct {
+	Prefecture string            `json:"prefecture"`
+	Params     *forecast.Params  `json:"params"`
+	Backtest   *ForecastBacktest `json:"backtest"`
+	Forecast   []ForecastPoint   `json:"forecast"`
+}
+
+// CSV・NDJSON出力用の1行
+type ForecastRow struct {
+	Prefecture string `json:"prefecture"`
+	ForecastPoint
+	Alpha    float64  `json:"alpha"`
+	Beta     float64  `json:"beta"`
+	Gamma    float64  `json:"gamma"`
+	MAE      float64  `json:"mae"`
+	MAPE     *float64 `json:"mape"`
+	Coverage float64  `json:"coverage"`
+}
+
+type ForecastResult struct {
+	Date        time.Time        `json:"date"`
+	Horizon     int              `json:"horizon"`
+	History     int              `json:"history"`
+	Confidence  float64          `json:"confidence"`
+	Prefectures []ForecastSeries `json:"prefectures"`
+}
+
+func parseForecast(req events.APIGatewayProxyRequest) (forecastOptions, error) {
+	opts := forecastOptions{horizon: defaultHorizon, history: defaultHistory, confidence: 0.95}
+	//バックテストを1回以上行えるようにする（起点までに3周期分の履歴が必要）
+	minHistory := 3*forecast.Season + maxHorizon
+	for _, param := range []struct {
+		key      string
+		val      *int
+		min, max int
+	}{{"horizon", &opts.horizon, minHorizon, maxHorizon}, {"history", &opts.history, minHistory, maxHistory}} {
+		val := req.QueryStringParameters[param.key]
+		if val == "" {
+			continue
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil || n < param.min || n > param.max {
+			return opts, problem.BadRequest("invalid %s: %s (want %d-%d)", param.key, val, param.min, param.max)
+		}
+		*param.val = n
+	}
+	if val := req.QueryStringParameters["confidence"]; val != "" {
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil || !(f > 0) || !(f < 1) {
+			return opts, problem.BadRequest("invalid confidence: %s (want 0-1 exclusive)", val)
+		}
+		opts.confidence = f
+	}
+	return opts, nil
+}
+
+// 日次感染者数の系列（古い順、最終日が基準日）から予測する
+func forecastSeries(name string, y []float64, date time.Time, opts forecastOptions) (ForecastSeries, error) {
+	s := ForecastSeries{Prefecture: name, Forecast: make([]ForecastPoint, 0)}
+	if y == nil {
+		return s, nil
+	}
+	m, err := forecast.Fit(y)
+	if err != nil {
+		return s, err
+	}
+	b, err := forecast.Evaluate(y, opts.horizon, backtestFolds, opts.confidence)
+	if err != nil {
+		return s, err
+	}
+
+	s.Params = &m.Params
+	s.Backtest = &ForecastBacktest{Horizon: b.Horizon, Folds: b.Folds, MAE: round2(b.MAE), MAPE: finite(b.MAPE, 2), Coverage: round2(b.Coverage)}
+	for _, p := range m.Forecast(opts.horizon, opts.confidence) {
+		s.Forecast = append(s.Forecast, ForecastPoint{
+			Date:                 date.AddDate(0, 0, p.Step),
+			InfectionNumberDaily: round2(p.Mean),
+			Lower:                round2(p.Lower),
+			Upper:                round2(p.Upper),
+		})
+	}
+	return s, nil
+}
+
+func getStatusForecast(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	opts, err := parseForecast(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	date := clock.DaysAgo(clk, 1)
+	if val := req.QueryStringParameters["date"]; val != "" {
+		if date, err = parseDate("date", val); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+	from := date.AddDate(0, 0, 1-opts.history)
+
+	query, args, err := seriesQuery(req, from, date)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer db.Close()
+
+	infectionStatusList, err := selectStatus(db, query, args)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	result := ForecastResult{Date: date, Horizon: opts.horizon, History: opts.history, Confidence: opts.confidence, Prefectures: make([]ForecastSeries, 0)}
+	series := dailySeries(infectionStatusList, from, opts.history)
+	rows := make([]ForecastRow, 0)
+	for _, name := range prefecture.Names {
+		y, ok := series[name]
+		if !ok {
+			continue
+		}
+		s, err := forecastSeries(name, y, date, opts)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		result.Prefectures = append(result.Prefectures, s)
+		for _, p := range s.Forecast {
+			rows = append(rows, ForecastRow{
+				Prefecture:    name,
+				ForecastPoint: p,
+				Alpha:         s.Params.Alpha,
+				Beta:          s.Params.Beta,
+				Gamma:         s.Params.Gamma,
+				MAE:           s.Backtest.MAE,
+				MAPE:          s.Backtest.MAPE,
+				Coverage:      s.Backtest.Coverage,
+			})
+		}
+	}
+	return render.Respond(req, result, rows)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func Test_parseForecast(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    forecastOptions
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: forecastOptions{horizon: 7, history: 56, confidence: 0.95},
+		},
+		{
+			name:   "custom",
+			params: map[string]string{"horizon": "14", "history": "90", "confidence": "0.8"},
+			want:   forecastOptions{horizon: 14, history: 90, confidence: 0.8},
+		},
+		{
+			name:    "horizon too long",
+			params:  map[string]string{"horizon": "15"},
+			wantErr: true,
+		},
+		{
+			name:    "history too short",
+			params:  map[string]string{"history": "28"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseForecast(events.APIGatewayProxyRequest{QueryStringParameters: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseForecast() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseForecast() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_forecastSeries(t *testing.T) {
+	opts := forecastOptions{horizon: 14, history: 56, confidence: 0.95}
+	date := time.Date(2023, 2, 25, 0, 0, 0, 0, time.UTC)
+	y := make([]float64, opts.history)
+	for i := range y {
+		y[i] = math.Round(500 * []float64{1.3, 1.1, 1.0, 0.9, 0.9, 0.8, 1.0}[i%7])
+	}
+
+	got, err := forecastSeries("東京都", y, date, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Params == nil || got.Backtest == nil || got.Backtest.Folds != 2 || got.Backtest.MAPE == nil {
+		t.Fatalf("forecastSeries() = %+v", got)
+	}
+	if len(got.Forecast) != 14 || !got.Forecast[0].Date.Equal(date.AddDate(0, 0, 1)) || !got.Forecast[13].Date.Equal(date.AddDate(0, 0, 14)) {
+		t.Fatalf("forecast = %+v", got.Forecast)
+	}
+	//2023-02-26は系列の56日目（0始まり）で、曜日の係数は1.3
+	if p := got.Forecast[0]; math.Abs(p.InfectionNumberDaily-650) > 5 || p.Lower > p.InfectionNumberDaily || p.Upper < p.InfectionNumberDaily {
+		t.Errorf("forecast[0] = %+v", p)
+	}
+
+	//欠損日がある場合は予測しない
+	if got, err := forecastSeries("北海道", nil, date, opts); err != nil || got.Params != nil || len(got.Forecast) != 0 {
+		t.Errorf("forecastSeries() = %+v, %v", got, err)
+	}
+}
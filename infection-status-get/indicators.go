@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/epi"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+	"github.com/tsuvic/ca-geo-corona/internal/render"
+)
+
+const (
+	defaultRtWindow     = 7
+	defaultGrowthWindow = 14
+	maxIndicatorWindow  = 28
+	// 発症間隔の平均・標準偏差の上限（日）
+	maxSerialInterval = 30
+)
+
+// window: 実効再生産数の推定期間、growthWindow: 増加率の回帰期間、confidence: 区間の水準
+type indicatorOptions struct {
+	si           epi.SerialInterval
+	window       int
+	growthWindow int
+	confidence   float64
+}
+
+// 実効再生産数・増加率・倍加時間と、その区間
+// 倍加時間が負の場合は半減期間。推定できない場合はnull
+type Indicator struct {
+	Name              string   `json:"name"`
+	Rt                *float64 `json:"rt"`
+	RtLower           *float64 `json:"rtLower"`
+	RtUpper           *float64 `json:"rtUpper"`
+	GrowthRate        *float64 `json:"growthRate"`
+	GrowthRateLower   *float64 `json:"growthRateLower"`
+	GrowthRateUpper   *float64 `json:"growthRateUpper"`
+	DoublingTime      *float64 `json:"doublingTime"`
+	DoublingTimeLower *float64 `json:"doublingTimeLower"`
+	DoublingTimeUpper *float64 `json:"doublingTimeUpper"`
+}
+
+// CSV・NDJSON出力用の1行（levelはprefecture|region）
+type IndicatorRow struct {
+	Level string `json:"level"`
+	Indicator
+	Date time.Time `json:"date"`
+}
+
+type IndicatorResult struct {
+	Date           time.Time          `json:"date"`
+	SerialInterval epi.SerialInterval `json:"serialInterval"`
+	Window         int                `json:"window"`
+	GrowthWindow   int                `json:"growthWindow"`
+	Confidence     float64            `json:"confidence"`
+	Prefectures    []Indicator        `json:"prefectures"`
+	Regions        []Indicator        `json:"regions"`
+}
+
+func parseIndicators(req events.APIGatewayProxyRequest) (indicatorOptions, error) {
+	opts := indicatorOptions{si: epi.DefaultSerialInterval, window: defaultRtWindow, growthWindow: defaultGrowthWindow, confidence: 0.95}
+	for _, param := range []struct {
+		key      string
+		val      *int
+		min, max int
+	}{{"window", &opts.window, 1, maxIndicatorWindow}, {"growthWindow", &opts.growthWindow, 3, maxIndicatorWindow}} {
+		val := req.QueryStringParameters[param.key]
+		if val == "" {
+			continue
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil || n < param.min || n > param.max {
+			return opts, problem.BadRequest("invalid %s: %s (want %d-%d)", param.key, val, param.min, param.max)
+		}
+		*param.val = n
+	}
+	for _, param := range []struct {
+		key      string
+		val      *float64
+		min, max float64
+	}{{"siMean", &opts.si.Mean, 0, maxSerialInterval}, {"siSd", &opts.si.SD, 0, maxSerialInterval}, {"confidence", &opts.confidence, 0, 1}} {
+		val := req.QueryStringParameters[param.key]
+		if val == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil || !(f > param.min) || !(f < param.max) {
+			return opts, problem.BadRequest("invalid %s: %s (want %g-%g exclusive)", param.key, val, param.min, param.max)
+		}
+		*param.val = f
+	}
+	return opts, nil
+}
+
+// 基準日までに必要な日数（発症間隔の最大日数 + 推定期間）
+func (o indicatorOptions) days() int {
+	days := len(o.si.Weights()) - 1 + o.window
+	if days < o.growthWindow {
+		days = o.growthWindow
+	}
+	return days
+}
+
+// 日次感染者数の系列（古い順、最終日が基準日）から指標を算出する
+func indicator(name string, incidence []float64, opts indicatorOptions) Indicator {
+	ind := Indicator{Name: name}
+	if incidence == nil {
+		return ind
+	}
+
+	if list := epi.EstimateRt(incidence, opts.si, opts.window, opts.confidence); len(list) > 0 {
+		if rt := list[len(list)-1]; rt.Index == len(incidence)-1 {
+			ind.Rt, ind.RtLower, ind.RtUpper = finite(rt.Mean, 2), finite(rt.Lower, 2), finite(rt.Upper, 2)
+		}
+	}
+
+	g, ok := epi.EstimateGrowth(incidence[len(incidence)-opts.growthWindow:], opts.confidence)
+	if !ok {
+		return ind
+	}
+	ind.GrowthRate, ind.GrowthRateLower, ind.GrowthRateUpper = finite(g.Rate, 4), finite(g.Lower, 4), finite(g.Upper, 4)
+	ind.DoublingTime = finite(epi.DoublingTime(g.Rate), 2)
+	if lower, upper, ok := g.DoublingTime(); ok {
+		ind.DoublingTimeLower, ind.DoublingTimeUpper = finite(lower, 2), finite(upper, 2)
+	}
+	return ind
+}
+
+// 小数点以下digits桁に丸める。無限大・NaNはnull
+func finite(f float64, digits int) *float64 {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil
+	}
+	p := math.Pow(10, float64(digits))
+	f = math.Round(f*p) / p
+	return &f
+}
+
+// 都道府県別の期間内の日次感染者数の系列
+// 欠損日がある都道府県はnil。訂正による負の値は0とする
+func dailySeries(infectionStatusList []InfectionStatus, from time.Time, days int) map[string][]float64 {
+	series := make(map[string][]float64)
+	found := make(map[string]int)
+	for _, val := range infectionStatusList {
+		if !prefecture.Valid(val.Prefecture) {
+			continue
+		}
+		i := int(val.Date.Sub(from).Hours() / 24)
+		if i < 0 || i >= days {
+			continue
+		}
+		if series[val.Prefecture] == nil {
+			series[val.Prefecture] = make([]float64, days)
+		}
+		series[val.Prefecture][i] = math.Max(0, float64(val.InfectionNumberDaily))
+		found[val.Prefecture]++
+	}
+	for name, n := range found {
+		if n != days {
+			series[name] = nil
+		}
+	}
+	return series
+}
+
+// 都道府県別・地方別の指標（都道府県コード順、地方は北から順）
+// 地方は含まれる都道府県の合計から算出し、欠損のある都道府県を含む場合は推定しない
+func indicators(series map[string][]float64, days int, opts indicatorOptions) ([]Indicator, []Indicator) {
+	prefectures := make([]Indicator, 0, len(series))
+	for _, name := range prefecture.Names {
+		if s, ok := series[name]; ok {
+			prefectures = append(prefectures, indicator(name, s, opts))
+		}
+	}
+
+	regions := make([]Indicator, 0, len(prefecture.Regions))
+	for _, region := range prefecture.Regions {
+		sum := make([]float64, days)
+		found := false
+		for _, name := range region.Prefectures {
+			s, ok := series[name]
+			if !ok {
+				continue
+			}
+			if s == nil {
+				sum = nil
+			}
+			for i := range sum {
+				sum[i] += s[i]
+			}
+			found = true
+		}
+		if found {
+			regions = append(regions, indicator(region.Name, sum, opts))
+		}
+	}
+	return prefectures, regions
+}
+
+// 基準日までの期間の行を取得するクエリ
+// 日付の指定をfrom〜toに置き換え、都道府県・地方・asOfの指定はそのまま使う
+func seriesQuery(req events.APIGatewayProxyRequest, from, to time.Time) (string, []interface{}, error) {
+	seriesReq := events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{
+			"from": from.Format("20060102"),
+			"to":   to.Format("20060102"),
+			"asOf": req.QueryStringParameters["asOf"],
+		},
+		MultiValueQueryStringParameters: map[string][]string{
+			"prefecture": req.MultiValueQueryStringParameters["prefecture"],
+			"region":     req.MultiValueQueryStringParameters["region"],
+		},
+	}
+	fromClause, query, err := createFromClause(seriesReq)
+	if err != nil {
+		return "", nil, err
+	}
+	whereClause, whereQuery, err := createWhereClause(seriesReq)
+	if err != nil {
+		return "", nil, err
+	}
+	whereClause, whereQuery = excludeNational(seriesReq, whereClause, whereQuery)
+	query = append(query, whereQuery...)
+	return fmt.Sprintf("SELECT date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count FROM %s %s", fromClause, whereClause), query, nil
+}
+
+func getStatusIndicators(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	opts, err := parseIndicators(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	date := clock.DaysAgo(clk, 1)
+	if val := req.QueryStringParameters["date"]; val != "" {
+		if date, err = parseDate("date", val); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+	days := opts.days()
+	from := date.AddDate(0, 0, 1-days)
+
+	query, args, err := seriesQuery(req, from, date)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer db.Close()
+
+	infectionStatusList, err := selectStatus(db, query, args)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	result := IndicatorResult{Date: date, SerialInterval: opts.si, Window: opts.window, GrowthWindow: opts.growthWindow, Confidence: opts.confidence}
+	result.Prefectures, result.Regions = indicators(dailySeries(infectionStatusList, from, days), days, opts)
+
+	rows := make([]IndicatorRow, 0, len(result.Prefectures)+len(result.Regions))
+	for _, level := range []struct {
+		name string
+		list []Indicator
+	}{{"prefecture", result.Prefectures}, {"region", result.Regions}} {
+		for _, ind := range level.list {
+			rows = append(rows, IndicatorRow{Level: level.name, Indicator: ind, Date: date})
+		}
+	}
+	return render.Respond(req, result, rows)
+}
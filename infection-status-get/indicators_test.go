@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/epi"
+)
+
+func Test_parseIndicators(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    indicatorOptions
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: indicatorOptions{si: epi.DefaultSerialInterval, window: 7, growthWindow: 14, confidence: 0.95},
+		},
+		{
+			name:   "custom",
+			params: map[string]string{"window": "14", "growthWindow": "7", "siMean": "3.5", "siSd": "1.5", "confidence": "0.9"},
+			want:   indicatorOptions{si: epi.SerialInterval{Mean: 3.5, SD: 1.5}, window: 14, growthWindow: 7, confidence: 0.9},
+		},
+		{
+			name:    "growthWindow too short",
+			params:  map[string]string{"growthWindow": "2"},
+			wantErr: true,
+		},
+		{
+			name:    "siSd zero",
+			params:  map[string]string{"siSd": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "confidence out of range",
+			params:  map[string]string{"confidence": "95"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIndicators(events.APIGatewayProxyRequest{QueryStringParameters: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIndicators() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseIndicators() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_indicators(t *testing.T) {
+	opts := indicatorOptions{si: epi.DefaultSerialInterval, window: 7, growthWindow: 14, confidence: 0.95}
+	days := opts.days()
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	//東京都は1日10%増、神奈川県は一定、北海道は1日欠損
+	var list []InfectionStatus
+	for i := 0; i < days; i++ {
+		date := from.AddDate(0, 0, i)
+		list = append(list,
+			InfectionStatus{Date: date, Prefecture: "東京都", InfectionNumberDaily: int(math.Round(1000 * math.Exp(0.1*float64(i))))},
+			InfectionStatus{Date: date, Prefecture: "神奈川県", InfectionNumberDaily: 500},
+		)
+		if i != 3 {
+			list = append(list, InfectionStatus{Date: date, Prefecture: "北海道", InfectionNumberDaily: 100})
+		}
+	}
+
+	prefectures, regions := indicators(dailySeries(list, from, days), days, opts)
+	if len(prefectures) != 3 || prefectures[0].Name != "北海道" || prefectures[1].Name != "東京都" || prefectures[2].Name != "神奈川県" {
+		t.Fatalf("prefectures = %+v", prefectures)
+	}
+	if len(regions) != 2 || regions[0].Name != "北海道・東北地方" || regions[1].Name != "関東地方" {
+		t.Fatalf("regions = %+v", regions)
+	}
+
+	if hokkaido := prefectures[0]; hokkaido.Rt != nil || hokkaido.GrowthRate != nil {
+		t.Errorf("北海道 = %+v, want no estimate", hokkaido)
+	}
+	if regions[0].Rt != nil {
+		t.Errorf("北海道・東北地方 = %+v, want no estimate", regions[0])
+	}
+
+	tokyo := prefectures[1]
+	if tokyo.Rt == nil || *tokyo.Rt <= 1 || *tokyo.RtLower > *tokyo.Rt || *tokyo.RtUpper < *tokyo.Rt {
+		t.Errorf("東京都 Rt = %v [%v, %v]", tokyo.Rt, tokyo.RtLower, tokyo.RtUpper)
+	}
+	if tokyo.GrowthRate == nil || *tokyo.GrowthRate != 0.1 || tokyo.DoublingTime == nil || *tokyo.DoublingTime != 6.93 {
+		t.Errorf("東京都 growth = %v, doubling = %v", tokyo.GrowthRate, tokyo.DoublingTime)
+	}
+
+	kanagawa := prefectures[2]
+	if kanagawa.Rt == nil || *kanagawa.Rt != 1 {
+		t.Errorf("神奈川県 Rt = %v", kanagawa.Rt)
+	}
+	//横ばいの場合、倍加時間は求められない
+	if kanagawa.GrowthRate == nil || *kanagawa.GrowthRate != 0 || kanagawa.DoublingTime != nil || kanagawa.DoublingTimeLower != nil {
+		t.Errorf("神奈川県 growth = %v, doubling = %v", kanagawa.GrowthRate, kanagawa.DoublingTime)
+	}
+
+	//関東は東京都と神奈川県の合計
+	if kanto := regions[1]; kanto.Rt == nil || *kanto.Rt <= 1 || *kanto.Rt >= *tokyo.Rt {
+		t.Errorf("関東 Rt = %v", kanto.Rt)
+	}
+}
@@ -1,24 +1,49 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/httpcache"
+	"github.com/tsuvic/ca-geo-corona/internal/page"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+	"github.com/tsuvic/ca-geo-corona/internal/render"
 )
 
+// 日本時間で日付を判定する
+var clk clock.Clock = clock.System{}
+
 // https://qiita.com/dondoko-susumu/items/7285eab65a9dfa9e73e8
 type InfectionStatus struct {
 	Date                        time.Time `json:"date"`
 	Prefecture                  string    `json:"prefecture"`
 	InfectionNumberDaily        int       `json:"infectionNumberDaily"`
 	InfectionNumberCumulatively int       `json:"infectionNumberCumulatively"`
+	// 全国・地方の行のみ、集計に含まれる都道府県数（47未満は集計が不完全）
+	PrefectureCount *int `json:"prefectureCount,omitempty"`
+
+	//派生値（指定した場合のみ）
+	MovingAverage                      *float64 `json:"movingAverage,omitempty"`
+	Sum7                               *int     `json:"sum7,omitempty"`
+	InfectionNumberDailyPer100k        *float64 `json:"infectionNumberDailyPer100k,omitempty"`
+	InfectionNumberCumulativelyPer100k *float64 `json:"infectionNumberCumulativelyPer100k,omitempty"`
+	Sum7Per100k                        *float64 `json:"sum7Per100k,omitempty"`
+	InfectionNumberDailyAdjusted       *float64 `json:"infectionNumberDailyAdjusted,omitempty"`
+
+	//登録時に検出した異常値（anomalies=smooth|annotateの場合のみ）
+	Anomaly         *string  `json:"anomaly,omitempty"`
+	AnomalyExpected *float64 `json:"anomalyExpected,omitempty"`
 }
 
 func openDB() (*sql.DB, error) {
@@ -31,144 +56,778 @@ func openDB() (*sql.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", dbuser, dbpass, dbhost, dbname)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return nil, err
+		return nil, problem.Database(err)
 	}
 
 	if err = db.Ping(); err != nil {
-		return nil, err
+		db.Close()
+		return nil, problem.Database(err)
 	}
 	return db, nil
 }
 
+// 日付の指定はYYYYMMDD、YYYY-MM-DDのいずれか
+func parseDate(key, val string) (time.Time, error) {
+	for _, layout := range []string{"20060102", "2006-01-02"} {
+		if len(val) != len(layout) {
+			continue
+		}
+		if date, err := time.Parse(layout, val); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, problem.BadRequest("invalid %s: %q (want YYYYMMDD or YYYY-MM-DD)", key, val)
+}
+
+// prefectureとregion（地方に属する都道府県）を合わせた都道府県の検索条件
+func areaFilter(req events.APIGatewayProxyRequest) ([]string, error) {
+	qPrefecture := req.MultiValueQueryStringParameters["prefecture"]
+	qRegion := req.MultiValueQueryStringParameters["region"]
+	if len(qRegion) == 0 {
+		return qPrefecture, nil
+	}
+
+	prefectures := append([]string(nil), qPrefecture...)
+	for _, val := range qRegion {
+		region, ok := prefecture.LookupRegion(val)
+		if !ok {
+			return nil, problem.BadRequest("unknown region: %s", val)
+		}
+		for _, name := range region.Prefectures {
+			if !contains(prefectures, name) {
+				prefectures = append(prefectures, name)
+			}
+		}
+	}
+	return prefectures, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, val := range list {
+		if val == s {
+			return true
+		}
+	}
+	return false
+}
+
 // 複数日付の検索条件はOR、複数都道府県の検索条件はOR、日付と都道府県の検索条件はAND
+// regionは地方に属する都道府県の指定として扱う
+// from〜toは両端を含む期間で、日付の検索条件とAND
 func createWhereClause(req events.APIGatewayProxyRequest) (string, []interface{}, error) {
-	var dataClause string
+	var clauses []string
+	var query []interface{}
+
 	qDate := req.MultiValueQueryStringParameters["date"]
 	if len(qDate) > 0 {
 		dataClauses := make([]string, len(qDate))
-		for i, _ := range qDate {
+		for i, val := range qDate {
+			date, err := parseDate("date", val)
+			if err != nil {
+				return "", nil, err
+			}
 			dataClauses[i] = "date = ?"
+			query = append(query, date)
 		}
-		switch len(qDate) {
-		case 1:
-			dataClause = "(" + dataClauses[0] + ")"
-		default:
-			dataClause = "(" + strings.Join(dataClauses, " OR ") + ")"
+		clauses = append(clauses, "("+strings.Join(dataClauses, " OR ")+")")
+	}
+
+	var from, to time.Time
+	for _, param := range []struct {
+		key, op string
+		date    *time.Time
+	}{{"from", ">=", &from}, {"to", "<=", &to}} {
+		val := req.QueryStringParameters[param.key]
+		if val == "" {
+			continue
+		}
+		date, err := parseDate(param.key, val)
+		if err != nil {
+			return "", nil, err
 		}
+		*param.date = date
+		clauses = append(clauses, "date "+param.op+" ?")
+		query = append(query, date)
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return "", nil, problem.BadRequest("from %s is after to %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
 	}
 
-	var prefectureClause string
-	qPrefecture := req.MultiValueQueryStringParameters["prefecture"]
+	qPrefecture, err := areaFilter(req)
+	if err != nil {
+		return "", nil, err
+	}
 	if len(qPrefecture) > 0 {
 		prefectureClauses := make([]string, len(qPrefecture))
-		for i, _ := range qPrefecture {
+		for i, val := range qPrefecture {
 			prefectureClauses[i] = "prefecture = ?"
+			query = append(query, val)
 		}
-		switch len(qPrefecture) {
-		case 1:
-			prefectureClause = "(" + prefectureClauses[0] + ")"
-		default:
-			prefectureClause = "(" + strings.Join(prefectureClauses, " OR ") + ")"
+		clauses = append(clauses, "("+strings.Join(prefectureClauses, " OR ")+")")
+	}
+
+	if len(clauses) == 0 {
+		return "", make([]interface{}, 0), nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), query, nil
+}
+
+// 全国の行は prefecture=全国 を指定した場合のみ返却する
+func excludeNational(req events.APIGatewayProxyRequest, whereClause string, query []interface{}) (string, []interface{}) {
+	if len(req.MultiValueQueryStringParameters["prefecture"]) > 0 || len(req.MultiValueQueryStringParameters["region"]) > 0 {
+		return whereClause, query
+	}
+	if whereClause == "" {
+		whereClause = " WHERE prefecture <> ?"
+	} else {
+		whereClause += " AND prefecture <> ?"
+	}
+	return whereClause, append(query, prefecture.National)
+}
+
+// groupBy=prefecture（既定）|region|national
+func parseGroupBy(req events.APIGatewayProxyRequest) (string, error) {
+	switch groupBy := req.QueryStringParameters["groupBy"]; groupBy {
+	case "", "prefecture":
+		return "prefecture", nil
+	case "region", "national":
+		return groupBy, nil
+	default:
+		return "", problem.BadRequest("unknown groupBy: %s", groupBy)
+	}
+}
+
+// 集計単位の表示順（全国、都道府県コード順、地方は北から順）
+func areaOrder(name string) int {
+	if code := prefecture.Code(name); code > 0 {
+		return code
+	}
+	for i, region := range prefecture.Regions {
+		if region.Name == name {
+			return len(prefecture.Names) + 1 + i
 		}
 	}
+	return 0
+}
+
+// 都道府県別の行を地方別・全国に合算する
+// prefectureCountには合算した都道府県数を設定する（地方・全国の欠損の確認用）
+func groupRows(infectionStatusList []InfectionStatus, groupBy string) []InfectionStatus {
+	if groupBy == "prefecture" {
+		return infectionStatusList
+	}
 
-	var whereClause string
-	if len(qDate) > 0 && len(qPrefecture) > 0 {
-		whereClause = " WHERE " + dataClause + " AND " + prefectureClause
-	} else if len(qDate) > 0 && len(qPrefecture) == 0 {
-		whereClause = " WHERE " + dataClause
-	} else if len(qDate) == 0 && len(qPrefecture) > 0 {
-		whereClause = " WHERE " + prefectureClause
+	type key struct {
+		date time.Time
+		area string
+	}
+	grouped := make(map[key]*InfectionStatus)
+	for _, val := range infectionStatusList {
+		if !prefecture.Valid(val.Prefecture) {
+			continue
+		}
+		area := prefecture.National
+		if groupBy == "region" {
+			area = prefecture.RegionOf(val.Prefecture)
+		}
+		k := key{date: val.Date, area: area}
+		g, ok := grouped[k]
+		if !ok {
+			count := 0
+			g = &InfectionStatus{Date: val.Date, Prefecture: area, PrefectureCount: &count}
+			grouped[k] = g
+		}
+		g.InfectionNumberDaily += val.InfectionNumberDaily
+		g.InfectionNumberCumulatively += val.InfectionNumberCumulatively
+		*g.PrefectureCount++
 	}
 
-	query := make([]interface{}, 0, len(qDate)+len(qPrefecture))
-	for _, val := range qDate {
-		query = append(query, val)
+	//日付は元の行の順序のまま、同じ日付内は集計単位の表示順
+	dateOrder := make(map[time.Time]int)
+	for _, val := range infectionStatusList {
+		if _, ok := dateOrder[val.Date]; !ok {
+			dateOrder[val.Date] = len(dateOrder)
+		}
 	}
-	for _, val := range qPrefecture {
-		query = append(query, val)
+	groupedList := make([]InfectionStatus, 0, len(grouped))
+	for _, g := range grouped {
+		groupedList = append(groupedList, *g)
 	}
+	sort.Slice(groupedList, func(i, j int) bool {
+		if !groupedList[i].Date.Equal(groupedList[j].Date) {
+			return dateOrder[groupedList[i].Date] < dateOrder[groupedList[j].Date]
+		}
+		return areaOrder(groupedList[i].Prefecture) < areaOrder(groupedList[j].Prefecture)
+	})
+	return groupedList
+}
 
-	return whereClause, query, nil
+// 一覧のソート順（date: 日付・都道府県順、prefecture: 都道府県・日付順）
+var sorts = []page.Sort{
+	{Name: "date", Columns: []string{"date", "prefecture"}},
+	{Name: "prefecture", Columns: []string{"prefecture", "date"}},
+}
+
+func parsePage(req events.APIGatewayProxyRequest, groupBy string) (page.Page, error) {
+	p, err := page.Parse(sorts, req.QueryStringParameters["sort"], req.QueryStringParameters["limit"], req.QueryStringParameters["cursor"])
+	if err != nil {
+		return p, problem.BadRequest("%s", err)
+	}
+	//地方・全国の集計は日付単位でページを区切る
+	if groupBy != "prefecture" && p.Sort.Name != "date" {
+		return p, problem.BadRequest("sort=%s is not supported with groupBy=%s", p.Sort, groupBy)
+	}
+	return p, nil
+}
+
+// 1行多く取得した結果から次ページの有無を判定し、ページの行と次ページのカーソルを返す
+// 集計する場合は最終日の行が次ページにまたがらないよう、最終日の行を次ページに回す
+func paginate(p page.Page, infectionStatusList []InfectionStatus, groupBy string) ([]InfectionStatus, string, error) {
+	if len(infectionStatusList) <= p.Limit {
+		return infectionStatusList, "", nil
+	}
+	rows := infectionStatusList[:p.Limit]
+	if groupBy != "prefecture" {
+		next := infectionStatusList[p.Limit].Date
+		for len(rows) > 0 && rows[len(rows)-1].Date.Equal(next) {
+			rows = rows[:len(rows)-1]
+		}
+		if len(rows) == 0 {
+			return nil, "", problem.BadRequest("limit %d is too small for groupBy=%s", p.Limit, groupBy)
+		}
+	}
+
+	last := rows[len(rows)-1]
+	keys := map[string]string{"date": last.Date.Format("2006-01-02"), "prefecture": last.Prefecture}
+	cursorKeys := make([]string, len(p.Sort.Columns))
+	for i, column := range p.Sort.Columns {
+		cursorKeys[i] = keys[column]
+	}
+	return rows, p.Next(cursorKeys), nil
+}
+
+// asOfを指定した場合は、その時刻時点で取得済みだった値を infection_status として参照する
+func createFromClause(req events.APIGatewayProxyRequest) (string, []interface{}, error) {
+	qAsOf := req.QueryStringParameters["asOf"]
+	if qAsOf == "" {
+		return "infection_status", []interface{}{}, nil
+	}
+
+	asOf, err := time.Parse(time.RFC3339, qAsOf)
+	if err != nil {
+		return "", nil, problem.BadRequest("invalid asOf: %q (want RFC3339)", qAsOf)
+	}
+	fromClause := "(SELECT v.date, v.prefecture, v.infection_number_daily, v.infection_number_cumulatively, v.prefecture_count FROM infection_status_version v" +
+		" JOIN (SELECT date, prefecture, MAX(recorded_at) AS recorded_at FROM infection_status_version WHERE recorded_at <= ? GROUP BY date, prefecture) latest" +
+		" ON v.date = latest.date AND v.prefecture = latest.prefecture AND v.recorded_at = latest.recorded_at) AS infection_status"
+	return fromClause, []interface{}{asOf.UTC()}, nil
+}
+
+func selectStatus(db *sql.DB, query string, args []interface{}) ([]InfectionStatus, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infectionStatusList := make([]InfectionStatus, 0)
+	for rows.Next() {
+		//https://github.com/mattn/go-sqlite3/issues/190
+
+		var infectionStatus InfectionStatus
+		if err = rows.Scan(
+			&infectionStatus.Date,
+			&infectionStatus.Prefecture,
+			&infectionStatus.InfectionNumberDaily,
+			&infectionStatus.InfectionNumberCumulatively,
+			&infectionStatus.PrefectureCount,
+		); err != nil {
+			return nil, err
+		}
+
+		infectionStatusList = append(infectionStatusList, infectionStatus)
+	}
+	return infectionStatusList, rows.Err()
 }
 
 func getStatusDaily(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	groupBy, err := parseGroupBy(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	derived, err := parseDerived(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	anomalies, err := parseAnomalies(req, groupBy)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	p, err := parsePage(req, groupBy)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	fromClause, query, err := createFromClause(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	whereClause, whereQuery, err := createWhereClause(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	whereClause, whereQuery = excludeNational(req, whereClause, whereQuery)
+	if pageClause, pageQuery := p.Where(); pageClause != "" {
+		if whereClause == "" {
+			whereClause = " WHERE " + pageClause
+		} else {
+			whereClause += " AND " + pageClause
+		}
+		whereQuery = append(whereQuery, pageQuery...)
+	}
+	query = append(query, whereQuery...)
+
 	db, err := openDB()
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
+	defer db.Close()
 
+	infectionStatusList, err := selectStatus(db, fmt.Sprintf("SELECT date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count FROM %s %s%s", fromClause, whereClause, p.OrderBy()), query)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	infectionStatusList, next, err := paginate(p, infectionStatusList, groupBy)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if err := markAnomalies(db, infectionStatusList, anomalies); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	infectionStatusList = groupRows(infectionStatusList, groupBy)
+
+	if derived.enabled() {
+		history, err := selectHistory(db, req, infectionStatusList, groupBy, derived.window(), anomalies)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		addDerived(infectionStatusList, history, derived)
+	}
+
+	res, err := render.Respond(req, infectionStatusList, infectionStatusList)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if next != "" {
+		res.Headers["Link"] = page.Link(req.Path, page.RequestQuery(req), next)
+	}
+	return res, nil
+}
+
+// 取得時刻ごとの値の履歴（修正の経緯の確認用）
+type InfectionStatusVersion struct {
+	InfectionStatus
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+func getStatusHistory(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	whereClause, query, err := createWhereClause(req)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
+	whereClause, query = excludeNational(req, whereClause, query)
 
-	stmt, err := db.Prepare(fmt.Sprintf("SELECT date, prefecture, infection_number_daily, infection_number_cumulatively FROM infection_status %s", whereClause))
+	db, err := openDB()
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
+	defer db.Close()
 
-	rows, err := stmt.Query(query...)
+	rows, err := db.Query(fmt.Sprintf("SELECT date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count, recorded_at FROM infection_status_version %s ORDER BY date, prefecture, recorded_at", whereClause), query...)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
+	defer rows.Close()
 
-	infectionStatusList := make([]InfectionStatus, 0)
+	versionList := make([]InfectionStatusVersion, 0)
 	for rows.Next() {
-		//https://github.com/mattn/go-sqlite3/issues/190
+		var version InfectionStatusVersion
+		if err = rows.Scan(
+			&version.Date,
+			&version.Prefecture,
+			&version.InfectionNumberDaily,
+			&version.InfectionNumberCumulatively,
+			&version.PrefectureCount,
+			&version.RecordedAt,
+		); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		versionList = append(versionList, version)
+	}
+	if err = rows.Err(); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return render.Respond(req, versionList, versionList)
+}
+
+// 累積感染者数の都道府県別の時系列
+type CumulativeSeries struct {
+	Prefecture string            `json:"prefecture"`
+	Series     []CumulativePoint `json:"series"`
+}
+
+type CumulativePoint struct {
+	Date                        time.Time `json:"date"`
+	InfectionNumberCumulatively int       `json:"infectionNumberCumulatively"`
+	PrefectureCount             *int      `json:"prefectureCount,omitempty"`
+}
+
+// CSV・NDJSON出力用の1行
+type CumulativeRow struct {
+	Prefecture string `json:"prefecture"`
+	CumulativePoint
+}
+
+// 週（ISO週）・月ごとに期間内の最後の値を残す
+func resample(points []CumulativePoint, period string) []CumulativePoint {
+	var key func(t time.Time) int
+	switch period {
+	case "weekly":
+		key = func(t time.Time) int {
+			year, week := t.ISOWeek()
+			return year*100 + week
+		}
+	case "monthly":
+		key = func(t time.Time) int { return t.Year()*100 + int(t.Month()) }
+	default:
+		return points
+	}
+
+	resampled := make([]CumulativePoint, 0, len(points))
+	for i, point := range points {
+		if i+1 < len(points) && key(points[i+1].Date) == key(point.Date) {
+			continue
+		}
+		resampled = append(resampled, point)
+	}
+	return resampled
+}
+
+func getStatusCumulatively(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	period := req.QueryStringParameters["resample"]
+	switch period {
+	case "", "daily", "weekly", "monthly":
+	default:
+		return events.APIGatewayProxyResponse{}, problem.BadRequest("unknown resample: %s", period)
+	}
+	groupBy, err := parseGroupBy(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	fromClause, query, err := createFromClause(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
 
+	whereClause, whereQuery, err := createWhereClause(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	whereClause, whereQuery = excludeNational(req, whereClause, whereQuery)
+	query = append(query, whereQuery...)
+
+	db, err := openDB()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(fmt.Sprintf("SELECT date, prefecture, infection_number_cumulatively, prefecture_count FROM %s %s ORDER BY date", fromClause, whereClause), query...)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer rows.Close()
+
+	infectionStatusList := make([]InfectionStatus, 0)
+	for rows.Next() {
 		var infectionStatus InfectionStatus
 		if err = rows.Scan(
 			&infectionStatus.Date,
 			&infectionStatus.Prefecture,
-			&infectionStatus.InfectionNumberDaily,
 			&infectionStatus.InfectionNumberCumulatively,
+			&infectionStatus.PrefectureCount,
 		); err != nil {
 			return events.APIGatewayProxyResponse{}, err
 		}
-
 		infectionStatusList = append(infectionStatusList, infectionStatus)
 	}
 	if err = rows.Err(); err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	bytes, err := json.Marshal(infectionStatusList)
+	//集計単位ごとに日付順の時系列にまとめる
+	seriesMap := make(map[string][]CumulativePoint)
+	for _, val := range groupRows(infectionStatusList, groupBy) {
+		seriesMap[val.Prefecture] = append(seriesMap[val.Prefecture], CumulativePoint{
+			Date:                        val.Date,
+			InfectionNumberCumulatively: val.InfectionNumberCumulatively,
+			PrefectureCount:             val.PrefectureCount,
+		})
+	}
+
+	seriesList := make([]CumulativeSeries, 0, len(seriesMap))
+	for name, points := range seriesMap {
+		seriesList = append(seriesList, CumulativeSeries{Prefecture: name, Series: resample(points, period)})
+	}
+	sort.Slice(seriesList, func(i, j int) bool {
+		return areaOrder(seriesList[i].Prefecture) < areaOrder(seriesList[j].Prefecture)
+	})
+
+	cumulativeRows := make([]CumulativeRow, 0)
+	for _, series := range seriesList {
+		for _, point := range series.Series {
+			cumulativeRows = append(cumulativeRows, CumulativeRow{Prefecture: series.Prefecture, CumulativePoint: point})
+		}
+	}
+	return render.Respond(req, seriesList, cumulativeRows)
+}
+
+// 比較期間（両端を含む）
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// 2期間の日次感染者数の合計の比較
+// 前期間が0件の場合、変化率はnull
+type Comparison struct {
+	Name       string   `json:"name"`
+	Current    int      `json:"current"`
+	Previous   int      `json:"previous"`
+	Change     int      `json:"change"`
+	ChangeRate *float64 `json:"changeRate"`
+}
+
+// CSV・NDJSON出力用の1行（levelはprefecture|region）
+type ComparisonRow struct {
+	Level string `json:"level"`
+	Comparison
+	CurrentFrom  time.Time `json:"currentFrom"`
+	CurrentTo    time.Time `json:"currentTo"`
+	PreviousFrom time.Time `json:"previousFrom"`
+	PreviousTo   time.Time `json:"previousTo"`
+}
+
+type ComparisonResult struct {
+	Current     Period       `json:"current"`
+	Previous    Period       `json:"previous"`
+	Prefectures []Comparison `json:"prefectures"`
+	Regions     []Comparison `json:"regions"`
+}
+
+func newComparison(name string, current, previous int) Comparison {
+	c := Comparison{Name: name, Current: current, Previous: previous, Change: current - previous}
+	if previous != 0 {
+		//小数第1位までのパーセント
+		rate := math.Round(float64(current-previous)/float64(previous)*1000) / 10
+		c.ChangeRate = &rate
+	}
+	return c
+}
+
+// 比較期間の決定
+// period=week（既定）は昨日までの7日間と、その前の7日間
+// currentFrom, currentTo, previousFrom, previousTo で任意の2期間を指定できる
+func comparisonPeriods(req events.APIGatewayProxyRequest) (Period, Period, error) {
+	keys := []string{"currentFrom", "currentTo", "previousFrom", "previousTo"}
+	var dates []time.Time
+	for _, key := range keys {
+		val := req.QueryStringParameters[key]
+		if val == "" {
+			continue
+		}
+		date, err := parseDate(key, val)
+		if err != nil {
+			return Period{}, Period{}, err
+		}
+		dates = append(dates, date)
+	}
+
+	switch {
+	case len(dates) == len(keys):
+		current, previous := Period{From: dates[0], To: dates[1]}, Period{From: dates[2], To: dates[3]}
+		if current.To.Before(current.From) || previous.To.Before(previous.From) {
+			return Period{}, Period{}, problem.BadRequest("from is after to")
+		}
+		return current, previous, nil
+	case len(dates) > 0:
+		return Period{}, Period{}, problem.BadRequest("currentFrom, currentTo, previousFrom and previousTo are required")
+	}
+
+	switch period := req.QueryStringParameters["period"]; period {
+	case "", "week":
+		to := clock.DaysAgo(clk, 1)
+		current := Period{From: to.AddDate(0, 0, -6), To: to}
+		previous := Period{From: current.From.AddDate(0, 0, -7), To: current.From.AddDate(0, 0, -1)}
+		return current, previous, nil
+	default:
+		return Period{}, Period{}, problem.BadRequest("unknown period: %s", period)
+	}
+}
+
+// 都道府県別・地方別の比較（都道府県コード順、地方は北から順）
+func compare(current, previous map[string]int) ([]Comparison, []Comparison) {
+	prefectures := make([]Comparison, 0, len(current))
+	for _, name := range prefecture.Names {
+		_, okCurrent := current[name]
+		_, okPrevious := previous[name]
+		if okCurrent || okPrevious {
+			prefectures = append(prefectures, newComparison(name, current[name], previous[name]))
+		}
+	}
+
+	regions := make([]Comparison, 0, len(prefecture.Regions))
+	for _, region := range prefecture.Regions {
+		var sumCurrent, sumPrevious int
+		var found bool
+		for _, name := range region.Prefectures {
+			_, okCurrent := current[name]
+			_, okPrevious := previous[name]
+			found = found || okCurrent || okPrevious
+			sumCurrent += current[name]
+			sumPrevious += previous[name]
+		}
+		if found {
+			regions = append(regions, newComparison(region.Name, sumCurrent, sumPrevious))
+		}
+	}
+	return prefectures, regions
+}
+
+// 期間内の都道府県別の日次感染者数の合計
+// requireFullWindowの場合は期間内の全日のデータがある都道府県のみ返す
+func sumDaily(db *sql.DB, req events.APIGatewayProxyRequest, period Period, requireFullWindow bool) (map[string]int, error) {
+	fromClause, query, err := createFromClause(req)
+	if err != nil {
+		return nil, err
+	}
+
+	whereClause := " WHERE date >= ? AND date <= ? AND prefecture <> ?"
+	query = append(query, period.From, period.To, prefecture.National)
+	qPrefecture, err := areaFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(qPrefecture) > 0 {
+		whereClause += " AND prefecture IN (?" + strings.Repeat(", ?", len(qPrefecture)-1) + ")"
+		for _, val := range qPrefecture {
+			query = append(query, val)
+		}
+	}
+
+	havingClause := ""
+	if requireFullWindow {
+		havingClause = " HAVING COUNT(*) = ?"
+		query = append(query, int(period.To.Sub(period.From).Hours()/24)+1)
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT prefecture, SUM(infection_number_daily) FROM %s %s GROUP BY prefecture%s", fromClause, whereClause, havingClause), query...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var sum int
+		if err = rows.Scan(&name, &sum); err != nil {
+			return nil, err
+		}
+		sums[name] = sum
+	}
+	return sums, rows.Err()
+}
+
+func getStatusComparison(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	current, previous, err := comparisonPeriods(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if _, _, err = createFromClause(req); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if _, err = areaFilter(req); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	db, err := openDB()
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	fmt.Printf("Body Size : %d Byte \n", len(bytes))
+	defer db.Close()
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Body:       string(bytes),
-	}, nil
+	currentSums, err := sumDaily(db, req, current, false)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	previousSums, err := sumDaily(db, req, previous, false)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	result := ComparisonResult{Current: current, Previous: previous}
+	result.Prefectures, result.Regions = compare(currentSums, previousSums)
+
+	rows := make([]ComparisonRow, 0, len(result.Prefectures)+len(result.Regions))
+	for _, level := range []struct {
+		name string
+		list []Comparison
+	}{{"prefecture", result.Prefectures}, {"region", result.Regions}} {
+		for _, c := range level.list {
+			rows = append(rows, ComparisonRow{Level: level.name, Comparison: c, CurrentFrom: current.From, CurrentTo: current.To, PreviousFrom: previous.From, PreviousTo: previous.To})
+		}
+	}
+	return render.Respond(req, result, rows)
 }
 
-func getStatusCumulatively(events.APIGatewayProxyRequest) {}
-func getStatusComparison(events.APIGatewayProxyRequest)   {}
+func handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	//出力形式の指定誤りはDB接続前に返却する
+	if _, err := render.FromRequest(req); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
 
-func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var res events.APIGatewayProxyResponse
 	var err error
-	switch req.PathParameters["type"] {
+	switch t := req.PathParameters["type"]; t {
 	case "daily":
 		res, err = getStatusDaily(req)
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-	case "cumuratively":
-		getStatusCumulatively(req)
+	case "history":
+		res, err = getStatusHistory(req)
+	//cumuratively は旧パス
+	case "cumulatively", "cumuratively":
+		res, err = getStatusCumulatively(req)
 	case "comparison":
-		getStatusComparison(req)
+		res, err = getStatusComparison(req)
+	case "ranking":
+		res, err = getStatusRanking(req)
+	case "indicators":
+		res, err = getStatusIndicators(req)
+	case "forecast":
+		res, err = getStatusForecast(req)
+	default:
+		return events.APIGatewayProxyResponse{}, problem.NotFound("unknown type: %s", t)
 	}
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: res.StatusCode,
-		Body:       res.Body,
-	}, nil
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	//次回の取込までキャッシュさせる
+	return httpcache.Apply(req, res, clk.Now()), nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(problem.Wrap(handler))
 }
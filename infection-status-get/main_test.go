@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/page"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
 )
 
 func Test_createWhereClause(t *testing.T) {
@@ -39,9 +46,70 @@ func Test_createWhereClause(t *testing.T) {
 				},
 			},
 			want:    " WHERE (date = ?)",
-			want1:   []interface{}{"20230101"},
+			want1:   []interface{}{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
 			wantErr: false,
 		},
+		{
+			name: "date: hyphenated and prefecture",
+			args: args{
+				events.APIGatewayProxyRequest{
+					MultiValueQueryStringParameters: map[string][]string{"date": {"2023-01-01", "20230102"}, "prefecture": {"東京都"}},
+				},
+			},
+			want:    " WHERE (date = ? OR date = ?) AND (prefecture = ?)",
+			want1:   []interface{}{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), "東京都"},
+			wantErr: false,
+		},
+		{
+			name: "from and to",
+			args: args{
+				events.APIGatewayProxyRequest{
+					QueryStringParameters:           map[string]string{"from": "20230101", "to": "2023-01-31"},
+					MultiValueQueryStringParameters: map[string][]string{"prefecture": {"東京都"}},
+				},
+			},
+			want:    " WHERE date >= ? AND date <= ? AND (prefecture = ?)",
+			want1:   []interface{}{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC), "東京都"},
+			wantErr: false,
+		},
+		{
+			name: "from only",
+			args: args{
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{"from": "20230101"},
+				},
+			},
+			want:    " WHERE date >= ?",
+			want1:   []interface{}{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+			wantErr: false,
+		},
+		{
+			name: "inverted range",
+			args: args{
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{"from": "20230131", "to": "20230101"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed date",
+			args: args{
+				events.APIGatewayProxyRequest{
+					MultiValueQueryStringParameters: map[string][]string{"date": {"2023-1-1"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid date",
+			args: args{
+				events.APIGatewayProxyRequest{
+					MultiValueQueryStringParameters: map[string][]string{"date": {"20230230"}},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -60,6 +128,280 @@ func Test_createWhereClause(t *testing.T) {
 	}
 }
 
+func Test_createFromClause(t *testing.T) {
+	type args struct {
+		req events.APIGatewayProxyRequest
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		want1   []interface{}
+		wantErr bool
+	}{
+		{
+			name: "no asOf",
+			args: args{
+				events.APIGatewayProxyRequest{},
+			},
+			want:    "infection_status",
+			want1:   []interface{}{},
+			wantErr: false,
+		},
+		{
+			name: "asOf",
+			args: args{
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{"asOf": "2023-01-02T09:00:00+09:00"},
+				},
+			},
+			want: "(SELECT v.date, v.prefecture, v.infection_number_daily, v.infection_number_cumulatively, v.prefecture_count FROM infection_status_version v" +
+				" JOIN (SELECT date, prefecture, MAX(recorded_at) AS recorded_at FROM infection_status_version WHERE recorded_at <= ? GROUP BY date, prefecture) latest" +
+				" ON v.date = latest.date AND v.prefecture = latest.prefecture AND v.recorded_at = latest.recorded_at) AS infection_status",
+			want1:   []interface{}{time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+			wantErr: false,
+		},
+		{
+			name: "invalid asOf",
+			args: args{
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{"asOf": "20230102"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1, err := createFromClause(tt.args.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createFromClause() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("createFromClause() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("createFromClause() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_areaFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string][]string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "prefecture",
+			params: map[string][]string{"prefecture": {"東京都"}},
+			want:   []string{"東京都"},
+		},
+		{
+			name:   "region and prefecture",
+			params: map[string][]string{"prefecture": {"東京都", "北海道"}, "region": {"近畿地方"}},
+			want:   []string{"東京都", "北海道", "滋賀県", "京都府", "大阪府", "兵庫県", "奈良県", "和歌山県"},
+		},
+		{
+			name:   "overlapping region",
+			params: map[string][]string{"prefecture": {"大阪府"}, "region": {"近畿地方"}},
+			want:   []string{"大阪府", "滋賀県", "京都府", "兵庫県", "奈良県", "和歌山県"},
+		},
+		{
+			name:    "unknown region",
+			params:  map[string][]string{"region": {"関東"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := areaFilter(events.APIGatewayProxyRequest{MultiValueQueryStringParameters: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("areaFilter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("areaFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_groupRows(t *testing.T) {
+	count := func(n int) *int { return &n }
+	day1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	list := []InfectionStatus{
+		{Date: day1, Prefecture: "大阪府", InfectionNumberDaily: 1, InfectionNumberCumulatively: 10},
+		{Date: day1, Prefecture: "東京都", InfectionNumberDaily: 2, InfectionNumberCumulatively: 20},
+		{Date: day1, Prefecture: "神奈川県", InfectionNumberDaily: 3, InfectionNumberCumulatively: 30},
+		{Date: day2, Prefecture: "東京都", InfectionNumberDaily: 4, InfectionNumberCumulatively: 24},
+		{Date: day2, Prefecture: "全国", InfectionNumberDaily: 4, InfectionNumberCumulatively: 24, PrefectureCount: count(1)},
+	}
+	tests := []struct {
+		name    string
+		groupBy string
+		want    []InfectionStatus
+	}{
+		{
+			name:    "prefecture",
+			groupBy: "prefecture",
+			want:    list,
+		},
+		{
+			name:    "region",
+			groupBy: "region",
+			want: []InfectionStatus{
+				{Date: day1, Prefecture: "関東地方", InfectionNumberDaily: 5, InfectionNumberCumulatively: 50, PrefectureCount: count(2)},
+				{Date: day1, Prefecture: "近畿地方", InfectionNumberDaily: 1, InfectionNumberCumulatively: 10, PrefectureCount: count(1)},
+				{Date: day2, Prefecture: "関東地方", InfectionNumberDaily: 4, InfectionNumberCumulatively: 24, PrefectureCount: count(1)},
+			},
+		},
+		{
+			name:    "national",
+			groupBy: "national",
+			want: []InfectionStatus{
+				{Date: day1, Prefecture: "全国", InfectionNumberDaily: 6, InfectionNumberCumulatively: 60, PrefectureCount: count(3)},
+				{Date: day2, Prefecture: "全国", InfectionNumberDaily: 4, InfectionNumberCumulatively: 24, PrefectureCount: count(1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupRows(list, tt.groupBy); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupRows() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_paginate(t *testing.T) {
+	day1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	list := []InfectionStatus{
+		{Date: day1, Prefecture: "大阪府"},
+		{Date: day1, Prefecture: "東京都"},
+		{Date: day2, Prefecture: "大阪府"},
+		{Date: day2, Prefecture: "東京都"},
+	}
+	cursor := func(p page.Page, keys ...string) string { return p.Next(keys) }
+	tests := []struct {
+		name     string
+		sort     string
+		limit    int
+		groupBy  string
+		want     []InfectionStatus
+		wantNext func(page.Page) string
+		wantErr  bool
+	}{
+		{
+			name:     "last page",
+			limit:    4,
+			groupBy:  "prefecture",
+			want:     list,
+			wantNext: func(page.Page) string { return "" },
+		},
+		{
+			name:     "next page",
+			limit:    3,
+			groupBy:  "prefecture",
+			want:     list[:3],
+			wantNext: func(p page.Page) string { return cursor(p, "2023-01-02", "大阪府") },
+		},
+		{
+			name:     "next page by prefecture",
+			sort:     "prefecture",
+			limit:    3,
+			groupBy:  "prefecture",
+			want:     list[:3],
+			wantNext: func(p page.Page) string { return cursor(p, "大阪府", "2023-01-02") },
+		},
+		{
+			name:     "grouped page ends with a whole day",
+			limit:    3,
+			groupBy:  "national",
+			want:     list[:2],
+			wantNext: func(p page.Page) string { return cursor(p, "2023-01-01", "東京都") },
+		},
+		{
+			name:    "limit smaller than a day",
+			limit:   1,
+			groupBy: "region",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := page.Parse(sorts, tt.sort, strconv.Itoa(tt.limit), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, next, err := paginate(p, list, tt.groupBy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("paginate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paginate() = %v, want %v", got, tt.want)
+			}
+			if want := tt.wantNext(p); next != want {
+				t.Errorf("paginate() next = %v, want %v", next, want)
+			}
+		})
+	}
+}
+
+func Test_excludeNational(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         events.APIGatewayProxyRequest
+		whereClause string
+		query       []interface{}
+		want        string
+		want1       []interface{}
+	}{
+		{
+			name:  "no query",
+			req:   events.APIGatewayProxyRequest{},
+			query: []interface{}{},
+			want:  " WHERE prefecture <> ?",
+			want1: []interface{}{"全国"},
+		},
+		{
+			name:        "date",
+			req:         events.APIGatewayProxyRequest{MultiValueQueryStringParameters: map[string][]string{"date": {"20230101"}}},
+			whereClause: " WHERE (date = ?)",
+			query:       []interface{}{"20230101"},
+			want:        " WHERE (date = ?) AND prefecture <> ?",
+			want1:       []interface{}{"20230101", "全国"},
+		},
+		{
+			name:        "prefecture",
+			req:         events.APIGatewayProxyRequest{MultiValueQueryStringParameters: map[string][]string{"prefecture": {"全国"}}},
+			whereClause: " WHERE (prefecture = ?)",
+			query:       []interface{}{"全国"},
+			want:        " WHERE (prefecture = ?)",
+			want1:       []interface{}{"全国"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := excludeNational(tt.req, tt.whereClause, tt.query)
+			if got != tt.want {
+				t.Errorf("excludeNational() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("excludeNational() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
 func Test_openDB(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -110,39 +452,64 @@ func Test_getStatusDaily(t *testing.T) {
 
 func Test_getStatusCumulatively(t *testing.T) {
 	type args struct {
-		in0 events.APIGatewayProxyRequest
+		req events.APIGatewayProxyRequest
 	}
 	tests := []struct {
-		name string
-		args args
+		name    string
+		args    args
+		want    events.APIGatewayProxyResponse
+		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name: "unknown resample",
+			args: args{
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{"resample": "yearly"},
+				},
+			},
+			want:    events.APIGatewayProxyResponse{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			getStatusCumulatively(tt.args.in0)
+			got, err := getStatusCumulatively(tt.args.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getStatusCumulatively() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getStatusCumulatively() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
 
-func Test_getStatusComparison(t *testing.T) {
-	type args struct {
-		in0 events.APIGatewayProxyRequest
+func Test_resample(t *testing.T) {
+	day := func(m time.Month, d, n int) CumulativePoint {
+		return CumulativePoint{Date: time.Date(2023, m, d, 0, 0, 0, 0, time.UTC), InfectionNumberCumulatively: n}
 	}
+	//2023/1/1は日曜日（ISO週では前週）
+	points := []CumulativePoint{day(1, 1, 1), day(1, 2, 2), day(1, 8, 3), day(1, 9, 4), day(1, 31, 5), day(2, 1, 6)}
 	tests := []struct {
-		name string
-		args args
+		name   string
+		period string
+		want   []CumulativePoint
 	}{
-		// TODO: Add test cases.
+		{name: "daily", period: "daily", want: points},
+		{name: "weekly", period: "weekly", want: []CumulativePoint{day(1, 1, 1), day(1, 8, 3), day(1, 9, 4), day(2, 1, 6)}},
+		{name: "monthly", period: "monthly", want: []CumulativePoint{day(1, 31, 5), day(2, 1, 6)}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			getStatusComparison(tt.args.in0)
+			if got := resample(points, tt.period); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resample() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
 
-func Test_handler(t *testing.T) {
+func Test_getStatusComparison(t *testing.T) {
 	type args struct {
 		req events.APIGatewayProxyRequest
 	}
@@ -152,17 +519,238 @@ func Test_handler(t *testing.T) {
 		want    events.APIGatewayProxyResponse
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name: "partial custom periods",
+			args: args{
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{"currentFrom": "20230108", "currentTo": "20230114"},
+				},
+			},
+			want:    events.APIGatewayProxyResponse{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := handler(tt.args.req)
+			got, err := getStatusComparison(tt.args.req)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("handler() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("getStatusComparison() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("handler() = %v, want %v", got, tt.want)
+				t.Errorf("getStatusComparison() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_comparisonPeriods(t *testing.T) {
+	//日本時間 2023/1/15 10:00
+	clk = clock.Fixed(time.Date(2023, 1, 15, 1, 0, 0, 0, time.UTC))
+	defer func() { clk = clock.System{} }()
+
+	day := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name         string
+		params       map[string]string
+		wantCurrent  Period
+		wantPrevious Period
+		wantErr      bool
+	}{
+		{
+			name:         "default week",
+			wantCurrent:  Period{From: day(8), To: day(14)},
+			wantPrevious: Period{From: day(1), To: day(7)},
+		},
+		{
+			name:         "custom",
+			params:       map[string]string{"currentFrom": "20230110", "currentTo": "20230112", "previousFrom": "20230103", "previousTo": "20230105"},
+			wantCurrent:  Period{From: day(10), To: day(12)},
+			wantPrevious: Period{From: day(3), To: day(5)},
+		},
+		{
+			name:    "inverted",
+			params:  map[string]string{"currentFrom": "20230112", "currentTo": "20230110", "previousFrom": "20230103", "previousTo": "20230105"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown period",
+			params:  map[string]string{"period": "month"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, previous, err := comparisonPeriods(events.APIGatewayProxyRequest{QueryStringParameters: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("comparisonPeriods() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if current != tt.wantCurrent || previous != tt.wantPrevious {
+				t.Errorf("comparisonPeriods() = %v, %v, want %v, %v", current, previous, tt.wantCurrent, tt.wantPrevious)
+			}
+		})
+	}
+}
+
+func Test_compare(t *testing.T) {
+	rate := func(f float64) *float64 { return &f }
+	current := map[string]int{"東京都": 150, "神奈川県": 50, "大阪府": 10}
+	previous := map[string]int{"東京都": 100, "神奈川県": 0}
+
+	prefectures, regions := compare(current, previous)
+	wantPrefectures := []Comparison{
+		{Name: "東京都", Current: 150, Previous: 100, Change: 50, ChangeRate: rate(50)},
+		{Name: "神奈川県", Current: 50, Previous: 0, Change: 50},
+		{Name: "大阪府", Current: 10, Previous: 0, Change: 10},
+	}
+	wantRegions := []Comparison{
+		{Name: "関東地方", Current: 200, Previous: 100, Change: 100, ChangeRate: rate(100)},
+		{Name: "近畿地方", Current: 10, Previous: 0, Change: 10},
+	}
+	if !reflect.DeepEqual(prefectures, wantPrefectures) {
+		t.Errorf("compare() prefectures = %+v, want %+v", prefectures, wantPrefectures)
+	}
+	if !reflect.DeepEqual(regions, wantRegions) {
+		t.Errorf("compare() regions = %+v, want %+v", regions, wantRegions)
+	}
+}
+
+func Test_handler(t *testing.T) {
+	type args struct {
+		req events.APIGatewayProxyRequest
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantStatus int
+		wantDetail string
+	}{
+		{
+			name: "unknown type",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters: map[string]string{"type": "weekly"},
+				},
+			},
+			wantStatus: 404,
+			wantDetail: "unknown type: weekly",
+		},
+		{
+			name: "unknown format",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:        map[string]string{"type": "daily"},
+					QueryStringParameters: map[string]string{"format": "xml"},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "unknown format: xml",
+		},
+		{
+			name: "not acceptable",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters: map[string]string{"type": "daily"},
+					Headers:        map[string]string{"accept": "text/html"},
+				},
+			},
+			wantStatus: 406,
+			wantDetail: "not acceptable: text/html",
+		},
+		{
+			name: "sort by prefecture with groupBy",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:        map[string]string{"type": "daily"},
+					QueryStringParameters: map[string]string{"groupBy": "region", "sort": "-prefecture"},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "sort=-prefecture is not supported with groupBy=region",
+		},
+		{
+			name: "invalid cursor",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:        map[string]string{"type": "daily"},
+					QueryStringParameters: map[string]string{"cursor": "xyz"},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "invalid cursor",
+		},
+		{
+			name: "unknown groupBy",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:        map[string]string{"type": "daily"},
+					QueryStringParameters: map[string]string{"groupBy": "city"},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "unknown groupBy: city",
+		},
+		{
+			name: "unknown region",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:                  map[string]string{"type": "comparison"},
+					MultiValueQueryStringParameters: map[string][]string{"region": {"関東"}},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "unknown region: 関東",
+		},
+		{
+			name: "malformed date",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:                  map[string]string{"type": "daily"},
+					MultiValueQueryStringParameters: map[string][]string{"date": {"2023/01/01"}},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "invalid date: \"2023/01/01\" (want YYYYMMDD or YYYY-MM-DD)",
+		},
+		{
+			name: "inverted range",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:        map[string]string{"type": "cumulatively"},
+					QueryStringParameters: map[string]string{"from": "20230131", "to": "20230101"},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "from 2023-01-31 is after to 2023-01-01",
+		},
+		{
+			name: "unknown resample",
+			args: args{
+				events.APIGatewayProxyRequest{
+					PathParameters:        map[string]string{"type": "cumuratively"},
+					QueryStringParameters: map[string]string{"resample": "yearly"},
+				},
+			},
+			wantStatus: 400,
+			wantDetail: "unknown resample: yearly",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := problem.Wrap(handler)(context.Background(), tt.args.req)
+			if err != nil {
+				t.Fatalf("handler() error = %v", err)
+			}
+			var body problem.Problem
+			if err := json.Unmarshal([]byte(got.Body), &body); err != nil {
+				t.Fatalf("handler() body = %s: %v", got.Body, err)
+			}
+			if got.StatusCode != tt.wantStatus || body.Status != tt.wantStatus {
+				t.Errorf("handler() status = %d, want %d", got.StatusCode, tt.wantStatus)
+			}
+			if body.Detail != tt.wantDetail {
+				t.Errorf("handler() detail = %q, want %q", body.Detail, tt.wantDetail)
 			}
 		})
 	}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+	"github.com/tsuvic/ca-geo-corona/internal/render"
+)
+
+const (
+	defaultRankingSize   = 10
+	defaultRankingWindow = 7
+	maxRankingWindow     = 28
+)
+
+// ランキングの指標
+// daily 基準日の日次感染者数、sum7 7日間の合計、wow 前期間からの増加率（%）、per100k 期間の合計の人口10万人あたり
+var rankingMetrics = []string{"daily", "sum7", "wow", "per100k"}
+
+type rankingOptions struct {
+	metric string
+	bottom bool
+	n      int
+	window int
+}
+
+// 順位が同じ場合は同順位とし、並びは都道府県コード順
+type Ranking struct {
+	Rank       int     `json:"rank"`
+	Prefecture string  `json:"prefecture"`
+	Value      float64 `json:"value"`
+	Current    int     `json:"current"`
+	Previous   *int    `json:"previous,omitempty"`
+	Population int     `json:"population,omitempty"`
+}
+
+// CSV・NDJSON出力用の1行
+type RankingRow struct {
+	Metric string `json:"metric"`
+	Ranking
+	CurrentFrom time.Time `json:"currentFrom"`
+	CurrentTo   time.Time `json:"currentTo"`
+}
+
+type RankingResult struct {
+	Metric      string    `json:"metric"`
+	Order       string    `json:"order"`
+	Current     Period    `json:"current"`
+	Previous    *Period   `json:"previous,omitempty"`
+	Prefectures []Ranking `json:"prefectures"`
+}
+
+// metric（既定はdaily）、order=top|bottom、n=件数（既定10）、window=期間の日数（既定7、daily・sum7では使用しない）
+func parseRanking(req events.APIGatewayProxyRequest) (rankingOptions, error) {
+	opts := rankingOptions{metric: "daily", n: defaultRankingSize, window: defaultRankingWindow}
+	if val := req.QueryStringParameters["metric"]; val != "" {
+		if !contains(rankingMetrics, val) {
+			return opts, problem.BadRequest("unknown metric: %s", val)
+		}
+		opts.metric = val
+	}
+	switch val := req.QueryStringParameters["order"]; val {
+	case "", "top":
+	case "bottom":
+		opts.bottom = true
+	default:
+		return opts, problem.BadRequest("unknown order: %s", val)
+	}
+	if val := req.QueryStringParameters["n"]; val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > len(prefecture.Names) {
+			return opts, problem.BadRequest("invalid n: %s (want 1-%d)", val, len(prefecture.Names))
+		}
+		opts.n = n
+	}
+	if val := req.QueryStringParameters["window"]; val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > maxRankingWindow {
+			return opts, problem.BadRequest("invalid window: %s (want 1-%d)", val, maxRankingWindow)
+		}
+		opts.window = n
+	}
+	return opts, nil
+}
+
+// 集計期間。基準日（date、既定は昨日）までのwindow日間と、wowの場合はその前のwindow日間
+func (o rankingOptions) periods(req events.APIGatewayProxyRequest) (Period, *Period, error) {
+	to := clock.DaysAgo(clk, 1)
+	if val := req.QueryStringParameters["date"]; val != "" {
+		date, err := parseDate("date", val)
+		if err != nil {
+			return Period{}, nil, err
+		}
+		to = date
+	}
+
+	window := o.window
+	switch o.metric {
+	case "daily":
+		window = 1
+	case "sum7":
+		window = 7
+	}
+	current := Period{From: to.AddDate(0, 0, 1-window), To: to}
+	if o.metric != "wow" {
+		return current, nil, nil
+	}
+	previous := Period{From: current.From.AddDate(0, 0, -window), To: current.From.AddDate(0, 0, -1)}
+	return current, &previous, nil
+}
+
+// 指標の値で並べ、上位（bottomの場合は下位）n件を返す
+// 値が算出できない都道府県（wowで前期間が0件など）は除く
+func rank(opts rankingOptions, current, previous map[string]int) []Ranking {
+	list := make([]Ranking, 0, len(current))
+	for _, name := range prefecture.Names {
+		n, ok := current[name]
+		if !ok {
+			continue
+		}
+		r := Ranking{Prefecture: name, Current: n, Value: float64(n)}
+		switch opts.metric {
+		case "wow":
+			p, ok := previous[name]
+			if !ok {
+				continue
+			}
+			rate := newComparison(name, n, p).ChangeRate
+			if rate == nil {
+				continue
+			}
+			r.Previous, r.Value = &p, *rate
+		case "per100k":
+			r.Population = prefecture.Population(name)
+			r.Value = *per100k(n, r.Population)
+		}
+		list = append(list, r)
+	}
+
+	//同値の場合は都道府県コード順のまま
+	sort.SliceStable(list, func(i, j int) bool {
+		if opts.bottom {
+			return list[i].Value < list[j].Value
+		}
+		return list[i].Value > list[j].Value
+	})
+	for i := range list {
+		list[i].Rank = i + 1
+		if i > 0 && list[i].Value == list[i-1].Value {
+			list[i].Rank = list[i-1].Rank
+		}
+	}
+	if len(list) > opts.n {
+		list = list[:opts.n]
+	}
+	return list
+}
+
+func getStatusRanking(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	opts, err := parseRanking(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	current, previous, err := opts.periods(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if _, _, err = createFromClause(req); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if _, err = areaFilter(req); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer db.Close()
+
+	currentSums, err := sumDaily(db, req, current, true)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	var previousSums map[string]int
+	if previous != nil {
+		if previousSums, err = sumDaily(db, req, *previous, true); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	result := RankingResult{Metric: opts.metric, Order: "top", Current: current, Previous: previous}
+	if opts.bottom {
+		result.Order = "bottom"
+	}
+	result.Prefectures = rank(opts, currentSums, previousSums)
+
+	rows := make([]RankingRow, 0, len(result.Prefectures))
+	for _, r := range result.Prefectures {
+		rows = append(rows, RankingRow{Metric: opts.metric, Ranking: r, CurrentFrom: current.From, CurrentTo: current.To})
+	}
+	return render.Respond(req, result, rows)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+)
+
+func Test_parseRanking(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    rankingOptions
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: rankingOptions{metric: "daily", n: 10, window: 7},
+		},
+		{
+			name:   "bottom wow",
+			params: map[string]string{"metric": "wow", "order": "bottom", "n": "5", "window": "14"},
+			want:   rankingOptions{metric: "wow", bottom: true, n: 5, window: 14},
+		},
+		{
+			name:    "unknown metric",
+			params:  map[string]string{"metric": "total"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown order",
+			params:  map[string]string{"order": "desc"},
+			wantErr: true,
+		},
+		{
+			name:    "n out of range",
+			params:  map[string]string{"n": "48"},
+			wantErr: true,
+		},
+		{
+			name:    "window out of range",
+			params:  map[string]string{"window": "0"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRanking(events.APIGatewayProxyRequest{QueryStringParameters: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRanking() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseRanking() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rankingPeriods(t *testing.T) {
+	clk = clock.Fixed(time.Date(2023, 1, 15, 10, 0, 0, 0, clock.Tokyo))
+	defer func() { clk = clock.System{} }()
+
+	date := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+	current, previous, err := rankingOptions{metric: "wow", window: 7}.periods(events.APIGatewayProxyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Period{From: date(8), To: date(14)}); current != want {
+		t.Errorf("current = %v, want %v", current, want)
+	}
+	if want := (Period{From: date(1), To: date(7)}); previous == nil || *previous != want {
+		t.Errorf("previous = %v, want %v", previous, want)
+	}
+
+	current, previous, err = rankingOptions{metric: "daily", window: 7}.periods(events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"date": "2023-01-10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Period{From: date(10), To: date(10)}); current != want || previous != nil {
+		t.Errorf("periods() = %v, %v, want %v", current, previous, want)
+	}
+
+	//sum7はwindowによらず7日間
+	current, _, err = rankingOptions{metric: "sum7", window: 14}.periods(events.APIGatewayProxyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Period{From: date(8), To: date(14)}); current != want {
+		t.Errorf("current = %v, want %v", current, want)
+	}
+}
+
+func Test_rank(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	current := map[string]int{"東京都": 100, "大阪府": 100, "北海道": 50, "沖縄県": 10}
+	previous := map[string]int{"東京都": 50, "大阪府": 100, "北海道": 0, "沖縄県": 20}
+	tests := []struct {
+		name string
+		opts rankingOptions
+		want []Ranking
+	}{
+		{
+			name: "top with tie",
+			opts: rankingOptions{metric: "sum7", n: 3},
+			want: []Ranking{
+				{Rank: 1, Prefecture: "東京都", Value: 100, Current: 100},
+				{Rank: 1, Prefecture: "大阪府", Value: 100, Current: 100},
+				{Rank: 3, Prefecture: "北海道", Value: 50, Current: 50},
+			},
+		},
+		{
+			name: "bottom",
+			opts: rankingOptions{metric: "daily", bottom: true, n: 2},
+			want: []Ranking{
+				{Rank: 1, Prefecture: "沖縄県", Value: 10, Current: 10},
+				{Rank: 2, Prefecture: "北海道", Value: 50, Current: 50},
+			},
+		},
+		{
+			name: "wow excludes zero previous",
+			opts: rankingOptions{metric: "wow", n: 10},
+			want: []Ranking{
+				{Rank: 1, Prefecture: "東京都", Value: 100, Current: 100, Previous: intPtr(50)},
+				{Rank: 2, Prefecture: "大阪府", Value: 0, Current: 100, Previous: intPtr(100)},
+				{Rank: 3, Prefecture: "沖縄県", Value: -50, Current: 10, Previous: intPtr(20)},
+			},
+		},
+		{
+			name: "per100k",
+			opts: rankingOptions{metric: "per100k", n: 1},
+			want: []Ranking{
+				{Rank: 1, Prefecture: "大阪府", Value: 1.13, Current: 100, Population: 8837685},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rank(tt.opts, current, previous); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rank() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	_ "embed"
 	"fmt"
+	"math"
 	"os"
 	"sort"
 	"time"
@@ -12,6 +14,10 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/golang/freetype/truetype"
 	"github.com/slack-go/slack"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+	"github.com/tsuvic/ca-geo-corona/internal/seasonal"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -31,18 +37,15 @@ type Key struct {
 	Prefecture string    `json:"prefecture"`
 }
 
+// 日本時間で日付を判定する
+var clk clock.Clock = clock.System{}
+
+// 曜日別の係数の推定に使う日数
+const adjustmentHistory = 56
+
 //go:embed Koruri-Bold.ttf
 var fontBytes []byte
 
-var regionDict = map[string][]string{
-	"1. 北海道・東北地方": {"北海道", "青森県", "岩手県", "宮城県", "秋田県", "山形県", "福島県"},
-	"2. 関東地方":     {"茨城県", "栃木県", "群馬県", "埼玉県", "千葉県", "東京都", "神奈川県"},
-	"3. 中部地方":     {"新潟県", "富山県", "石川県", "福井県", "山梨県", "長野県", "岐阜県", "静岡県", "愛知県", "三重県"},
-	"4. 近畿地方":     {"滋賀県", "京都府", "大阪府", "兵庫県", "奈良県", "和歌山県"},
-	"5. 中国・四国地方":  {"鳥取県", "島根県", "岡山県", "広島県", "山口県", "徳島県", "香川県", "愛媛県", "高知県"},
-	"6. 九州・沖縄地方":  {"福岡県", "佐賀県", "長崎県", "熊本県", "大分県", "宮崎県", "鹿児島県", "沖縄県"},
-}
-
 func openDB() (*sql.DB, error) {
 	var (
 		dbhost = os.Getenv("DBHOST")
@@ -53,11 +56,12 @@ func openDB() (*sql.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", dbuser, dbpass, dbhost, dbname)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return nil, err
+		return nil, problem.Database(err)
 	}
 
 	if err = db.Ping(); err != nil {
-		return nil, err
+		db.Close()
+		return nil, problem.Database(err)
 	}
 	return db, nil
 }
@@ -77,23 +81,106 @@ func compareByPrefecture(s1, s2 *chart.TimeSeries) bool {
 	return s1.Name < s2.Name
 }
 
-func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// 登録時に検出した異常値
+type Anomaly struct {
+	Reason               string
+	InfectionNumberDaily int
+	Expected             sql.NullFloat64
+}
+
+// 異常値の注記
+var anomalyLabels = map[string]string{
+	"negative": "訂正",
+	"outlier":  "急増",
+}
+
+// anomalies=show（既定）|smooth|annotate（環境変数 ANOMALIES）
+// smooth: 検出時の直近の中央値に置き換える、annotate: 点に注記を付ける
+func anomalyMode(req events.APIGatewayProxyRequest) (string, error) {
+	mode := req.QueryStringParameters["anomalies"]
+	if mode == "" {
+		mode = os.Getenv("ANOMALIES")
+	}
+	switch mode {
+	case "", "show":
+		return "show", nil
+	case "smooth", "annotate":
+		return mode, nil
+	default:
+		return "", problem.BadRequest("unknown anomalies: %s", mode)
+	}
+}
+
+func selectAnomalies(db *sql.DB, from, to time.Time) (map[Key]Anomaly, error) {
+	rows, err := db.Query("SELECT date, prefecture, reason, infection_number_daily, expected FROM infection_status_anomaly WHERE date >= ? AND date <= ?", from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalyMap := make(map[Key]Anomaly)
+	for rows.Next() {
+		var key Key
+		var anomaly Anomaly
+		if err := rows.Scan(&key.Date, &key.Prefecture, &anomaly.Reason, &anomaly.InfectionNumberDaily, &anomaly.Expected); err != nil {
+			return nil, err
+		}
+		anomalyMap[key] = anomaly
+	}
+	return anomalyMap, rows.Err()
+}
+
+// 検出時と値が同じ行の異常値（値が再訂正された行は対象外）
+func findAnomaly(anomalyMap map[Key]Anomaly, infectionStatus InfectionStatus) (Anomaly, bool) {
+	anomaly, ok := anomalyMap[Key{Date: infectionStatus.Date, Prefecture: infectionStatus.Prefecture}]
+	return anomaly, ok && anomaly.InfectionNumberDaily == infectionStatus.InfectionNumberDaily
+}
+
+// 曜日による変動の補正値の系列（係数はfrom以降の履歴から推定する）
+func adjustedSeries(prefectureName string, infectionStatusList []InfectionStatus, from time.Time, x []time.Time) (chart.TimeSeries, bool) {
+	daily := make(map[time.Time]float64)
+	for _, infectionStatus := range infectionStatusList {
+		daily[infectionStatus.Date] = float64(infectionStatus.InfectionNumberDaily)
+	}
+	var values []float64
+	for date := from; !date.After(x[len(x)-1]); date = date.AddDate(0, 0, 1) {
+		n, ok := daily[date]
+		if !ok {
+			n = math.NaN()
+		}
+		values = append(values, n)
+	}
+	factors, ok := seasonal.Estimate(from, values)
+	if !ok {
+		return chart.TimeSeries{}, false
+	}
+
+	adjustedChart := chart.TimeSeries{
+		Name:    prefectureName + "（補正）",
+		XValues: x,
+		Style:   chart.Style{StrokeDashArray: []float64{5, 5}},
+	}
+	for _, date := range x {
+		n, ok := daily[date]
+		if !ok {
+			return chart.TimeSeries{}, false
+		}
+		adjustedChart.YValues = append(adjustedChart.YValues, factors.Adjust(date, n))
+	}
+	return adjustedChart, true
+}
+
+func handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	//font
 	face, err := truetype.Parse(fontBytes)
 	if err != nil {
-		panic(err)
+		return events.APIGatewayProxyResponse{}, err
 	}
 
-	//x UTC
-	x := []time.Time{
-		time.Now().AddDate(0, 0, -8),
-		time.Now().AddDate(0, 0, -7),
-		time.Now().AddDate(0, 0, -6),
-		time.Now().AddDate(0, 0, -5),
-		time.Now().AddDate(0, 0, -4),
-		time.Now().AddDate(0, 0, -3),
-		time.Now().AddDate(0, 0, -2),
-		time.Now().AddDate(0, 0, -1),
+	//x 日本時間の8日前〜昨日
+	x := make([]time.Time, 0, 8)
+	for i := 8; i >= 1; i-- {
+		x = append(x, clock.DaysAgo(clk, i))
 	}
 
 	//y
@@ -102,10 +189,19 @@ func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse,
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	from := time.Now().AddDate(0, 0, -8).Format("2006-01-02")
-	to := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
-	q := fmt.Sprintf("SELECT date, prefecture, infection_number_daily FROM infection_status WHERE date >= '%s' AND date <= '%s'", from, to)
-	rows, err := db.Query(q)
+	//adjusted=true（環境変数 ADJUSTED）の場合、曜日による変動の補正値も描画する
+	adjusted := req.QueryStringParameters["adjusted"] == "true" || os.Getenv("ADJUSTED") == "true"
+	mode, err := anomalyMode(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	from := x[0]
+	to := x[len(x)-1]
+	if adjusted {
+		from = to.AddDate(0, 0, 1-adjustmentHistory)
+	}
+	rows, err := db.Query("SELECT date, prefecture, infection_number_daily FROM infection_status WHERE date >= ? AND date <= ? AND prefecture <> ?", from, to, prefecture.National)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
@@ -131,28 +227,75 @@ func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse,
 		}
 	}
 
+	anomalyMap := make(map[Key]Anomaly)
+	if mode != "show" {
+		if anomalyMap, err = selectAnomalies(db, from, to); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
 	//都道府県チャートの作成
 	var prefectureChartList []chart.TimeSeries
+	adjustedChartMap := make(map[string]chart.TimeSeries)
+	annotationChartMap := make(map[string]chart.AnnotationSeries)
 	for prefectureName, infectionStatusList := range infectionStatusMap {
 		prefectureChart := chart.TimeSeries{
 			Name:    prefectureName,
 			XValues: x,
 		}
+		annotationChart := chart.AnnotationSeries{Name: prefectureName}
+
+		//異常値の置き換え・注記
+		for i, infectionStatus := range infectionStatusList {
+			anomaly, ok := findAnomaly(anomalyMap, infectionStatus)
+			if !ok {
+				continue
+			}
+			switch mode {
+			//中央値がない負の値は0とする
+			case "smooth":
+				infectionStatusList[i].InfectionNumberDaily = 0
+				if anomaly.Expected.Valid {
+					infectionStatusList[i].InfectionNumberDaily = int(math.Round(anomaly.Expected.Float64))
+				}
+			case "annotate":
+				if infectionStatus.Date.Before(x[0]) {
+					continue
+				}
+				annotationChart.Annotations = append(annotationChart.Annotations, chart.Value2{
+					XValue: chart.TimeToFloat64(infectionStatus.Date),
+					YValue: float64(infectionStatus.InfectionNumberDaily),
+					Label:  prefectureName + " " + anomalyLabels[anomaly.Reason],
+				})
+			}
+		}
+		if len(annotationChart.Annotations) > 0 {
+			annotationChartMap[prefectureName] = annotationChart
+		}
 
 		//y軸の日付順をソート・y軸の作成
 		sort.Slice(infectionStatusList, func(i, j int) bool { return compareByDate(&infectionStatusList[i], &infectionStatusList[j]) })
 		for _, infectionStatus := range infectionStatusList {
+			if infectionStatus.Date.Before(x[0]) {
+				continue
+			}
 			prefectureChart.YValues = append(prefectureChart.YValues, float64(infectionStatus.InfectionNumberDaily))
 		}
 		prefectureChartList = append(prefectureChartList, prefectureChart)
+
+		if adjusted {
+			if adjustedChart, ok := adjustedSeries(prefectureName, infectionStatusList, from, x); ok {
+				adjustedChartMap[prefectureName] = adjustedChart
+			}
+		}
 	}
 	sort.Slice(prefectureChartList, func(i, j int) bool { return compareByPrefecture(&prefectureChartList[i], &prefectureChartList[j]) })
 
 	//地方チャートの作成
 	regionChartList := make([]chart.Chart, 0)
-	for regionName, prefectures := range regionDict {
+	for i, region := range prefecture.Regions {
 		regionChart := chart.Chart{
-			Title: regionName,
+			Title: fmt.Sprintf("%d. %s", i+1, region.Name),
 			Font:  face,
 			Background: chart.Style{
 				Padding: chart.Box{
@@ -161,11 +304,21 @@ func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse,
 				},
 			},
 		}
-		//都道府県チャートの挿入
-		for _, prefecture := range prefectures {
+		//都道府県チャートの挿入（補正値は同じ色の破線、異常値の注記は同じ色の枠）
+		for _, prefectureName := range region.Prefectures {
 			for _, prefectureChart := range prefectureChartList {
-				if prefecture == prefectureChart.Name {
+				if prefectureName == prefectureChart.Name {
+					color := chart.GetDefaultColor(len(regionChart.Series))
+					prefectureChart.Style.StrokeColor = color
 					regionChart.Series = append(regionChart.Series, prefectureChart)
+					if adjustedChart, ok := adjustedChartMap[prefectureName]; ok {
+						adjustedChart.Style.StrokeColor = color
+						regionChart.Series = append(regionChart.Series, adjustedChart)
+					}
+					if annotationChart, ok := annotationChartMap[prefectureName]; ok {
+						annotationChart.Style.StrokeColor = color
+						regionChart.Series = append(regionChart.Series, annotationChart)
+					}
 				}
 			}
 		}
@@ -211,6 +364,7 @@ func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse,
 	}, nil
 }
 
+// スケジュール実行のため、エラーはLambdaの失敗として返す（メトリクス・再試行の対象とする）
 func main() {
-	lambda.Start(handler)
+	lambda.Start(problem.Recover(handler))
 }
@@ -1,48 +1,25 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/ingest"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-var (
-	errNon200Response = errors.New("non 200 Response found")
-	errNoJsonResponse = errors.New("no JsonResponse in HTTP response")
-	endpoint          = "https://opendata.corona.go.jp/api/Covid19JapanAll"
-)
-
-type InfectionStatusTmp struct {
-	ErrorInfo struct {
-		ErrorFlag    string `json:"errorFlag"`
-		ErrorCode    string `json:"errorCode"`
-		ErrorMessage string `json:"errorMessage"`
-	} `json:"errorInfo"`
-	ItemList []struct {
-		Date      string `json:"date"`
-		NameJp    string `json:"name_jp"`
-		NPatients string `json:"npatients"`
-	} `json:"itemList"`
-}
-
-type InfectionStatus struct {
-	Date                        time.Time `json:"date"`
-	Prefecture                  string    `json:"prefecture"`
-	InfectionNumberDaily        int       `json:"infectionNumberDaily"`
-	InfectionNumberCumulatively int       `json:"infectionNumberCumulatively"`
-}
+// 日本時間で「昨日」を判定する
+var clk clock.Clock = clock.System{}
 
 type Key struct {
 	Date       time.Time
@@ -61,128 +38,48 @@ func openDB() (*sql.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", dbuser, dbpass, dbhost, dbname)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return nil, err
+		return nil, problem.Database(err)
 	}
 
 	if err = db.Ping(); err != nil {
-		return nil, err
+		db.Close()
+		return nil, problem.Database(err)
 	}
 	return db, nil
 }
 
-func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	//クエリパラメータ
-	base, err := url.Parse(endpoint)
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, nil
-	}
-	now := time.Now()
-	yesterday := now.AddDate(0, 0, -1)
-	param := yesterday.Format("20060102")
-	query := url.Values{}
-	query.Add("date", param)
-	base.RawQuery = query.Encode()
-
-	// //パスパラメータ
-	// endpoint, err := url.JoinPath(endpoint, param)
-	// if err != nil {
-	// 	return events.APIGatewayProxyResponse{}, nil
-	// }
-
-	res, err := http.Get(base.String())
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
-	}
-	if res.StatusCode != 200 {
-		return events.APIGatewayProxyResponse{}, errNon200Response
-	}
-
-	JsonResponse, err := io.ReadAll(res.Body)
+func handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	db, err := openDB()
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	if len(JsonResponse) == 0 {
-		return events.APIGatewayProxyResponse{}, errNoJsonResponse
-	}
-
-	//https://budougumi0617.github.io/2019/02/24/go-print-detail-of-json-syntax-error/
-	var infectionStatusTmp InfectionStatusTmp
-	if err = json.Unmarshal(JsonResponse, &infectionStatusTmp); err != nil {
-		return events.APIGatewayProxyResponse{}, err
-	}
+	defer db.Close()
 
-	db, err := openDB()
+	//前日が欠損している場合は遡って補完する
+	maxLookback, _ := strconv.Atoi(os.Getenv("MAX_LOOKBACK"))
+	source, err := ingest.NewSource(ctx, os.Getenv("REPLAY") == "true")
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-
-	var infectionStatusList []InfectionStatus
-	for _, val := range infectionStatusTmp.ItemList {
-		var infectionStatus InfectionStatus
-
-		//都道府県
-		infectionStatus.Prefecture = val.NameJp
-
-		//日付
-		layout := "2006-01-02"
-		t, err := time.Parse(layout, val.Date)
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-		infectionStatus.Date = t
-
-		//累積 感染者数
-		cumulative, err := strconv.Atoi(val.NPatients)
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-		infectionStatus.InfectionNumberCumulatively = cumulative
-
-		//日次 感染者数
-		q := "SELECT infection_number_cumulatively FROM infection_status WHERE date = ? AND prefecture = ? LIMIT 1"
-		var i int
-		dayBefore := infectionStatus.Date.AddDate(0, 0, -1)
-		if err := db.QueryRow(q, dayBefore, infectionStatus.Prefecture).Scan(&i); err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-		infectionStatus.InfectionNumberDaily = infectionStatus.InfectionNumberCumulatively - i
-
-		infectionStatusList = append(infectionStatusList, infectionStatus)
-	}
-
-	insert, err := db.Prepare(fmt.Sprintf("INSERT INTO %s (date, prefecture, infection_number_daily, infection_number_cumulatively) VALUES (?, ?, ?, ?)", "infection_status"))
+	ingester := ingest.Ingester{DB: db, Source: source, MaxLookback: maxLookback, Clock: clk}
+	yesterday := clock.DaysAgo(clk, 1)
+	report, err := ingester.IngestDay(ctx, yesterday)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	var rowsAffectedSum int64
-	for _, val := range infectionStatusList {
-		res, err := insert.Exec(val.Date, val.Prefecture, val.InfectionNumberDaily, val.InfectionNumberCumulatively)
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-
-		rowsAffected, err := res.RowsAffected()
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-		rowsAffectedSum += rowsAffected
-	}
-
-	body := fmt.Sprintf("Inserted %d rows.\n", rowsAffectedSum)
-
-	bytes, err := json.Marshal(infectionStatusList)
+	bytes, err := json.Marshal(report)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	fmt.Printf("Body Size : %d Byte \n", len(bytes))
+	fmt.Printf("%s\n", bytes)
 
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
-		Body:       body,
+		Body:       string(bytes),
 	}, nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(problem.Recover(handler))
 }
@@ -1,55 +1,35 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/ingest"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-var (
-	errNon200Response = errors.New("non 200 Response found")
-	errNoJsonResponse = errors.New("no JsonResponse in HTTP response")
-	endpoint          = "https://opendata.corona.go.jp/api/Covid19JapanAll"
-)
-
-type InfectionStatusTmp struct {
-	ErrorInfo struct {
-		ErrorFlag    string `json:"errorFlag"`
-		ErrorCode    string `json:"errorCode"`
-		ErrorMessage string `json:"errorMessage"`
-	} `json:"errorInfo"`
-	ItemList []struct {
-		Date      string `json:"date"`
-		NameJp    string `json:"name_jp"`
-		NPatients string `json:"npatients"`
-	} `json:"itemList"`
-}
-
-type InfectionStatus struct {
-	Date                        time.Time `json:"date"`
-	Prefecture                  string    `json:"prefecture"`
-	InfectionNumberDaily        int       `json:"infectionNumberDaily"`
-	InfectionNumberCumulatively int       `json:"infectionNumberCumulatively"`
-}
+// 日本時間で「昨日」を判定する
+var clk clock.Clock = clock.System{}
 
 type Key struct {
 	Date       time.Time
 	Prefecture string
 }
 
-func openDB() (*sql.DB, error) {
+// テストでは接続しないDBに差し替える
+var openDB = func() (*sql.DB, error) {
 	var (
 		dbhost = os.Getenv("DBHOST")
 		dbname = os.Getenv("DBNAME")
@@ -60,154 +40,142 @@ func openDB() (*sql.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", dbuser, dbpass, dbhost, dbname)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return nil, err
+		return nil, problem.Database(err)
 	}
 
 	if err = db.Ping(); err != nil {
-		return nil, err
+		db.Close()
+		return nil, problem.Database(err)
 	}
 	return db, nil
 }
 
-func handler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	db, err := openDB()
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
+func handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	//都道府県指定（未指定の場合は全都道府県）
+	prefectures := req.MultiValueQueryStringParameters["prefecture"]
+	for _, val := range prefectures {
+		if !prefecture.Valid(val) {
+			return events.APIGatewayProxyResponse{}, problem.BadRequest("unknown prefecture: %s", val)
+		}
 	}
-	defer db.Close()
 
-	var rowsAffectedSum int64
-	date := req.MultiValueQueryStringParameters["date"]
-	for _, val := range date {
+	//期間指定
+	from := req.QueryStringParameters["from"]
+	to := req.QueryStringParameters["to"]
+	var fromDate, toDate time.Time
+	if from != "" || to != "" {
+		var err error
+		if fromDate, toDate, err = parseRange(from, to); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
 
-		//エンドポイント作成（クエリパラメーター取得含む）
-		base, err := url.Parse(endpoint)
+	var days []time.Time
+	for _, val := range req.MultiValueQueryStringParameters["date"] {
+		day, err := time.Parse(ingest.DateLayout, val)
 		if err != nil {
-			return events.APIGatewayProxyResponse{}, nil
+			return events.APIGatewayProxyResponse{}, problem.BadRequest("invalid date: %s", val)
 		}
-		query := url.Values{}
-		query.Add("date", val)
+		days = append(days, day)
+	}
 
-		// prefecture := req.MultiValueQueryStringParameters["prefecture"]
-		// for _, val := range prefecture {
-		// 	query.Add("dateName", val)
-		// }
+	//replay=trueの指定誤りはDB接続前に返却する（環境変数 REPLAY の設定誤りは500）
+	replay := req.QueryStringParameters["replay"] == "true" || os.Getenv("REPLAY") == "true"
+	source, err := ingest.NewSource(ctx, replay)
+	if errors.Is(err, ingest.ErrReplayWithoutArchive) && req.QueryStringParameters["replay"] == "true" {
+		return events.APIGatewayProxyResponse{}, problem.BadRequest("%v", err)
+	}
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
 
-		base.RawQuery = query.Encode()
+	db, err := openDB()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer db.Close()
+	ingester := ingest.Ingester{DB: db, Source: source, MaxLookback: maxLookback(), Prefectures: prefectures, Clock: clk}
 
-		//エンドポイントコール
-		res, err := http.Get(base.String())
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-		if res.StatusCode != 200 {
-			return events.APIGatewayProxyResponse{}, errNon200Response
-		}
+	if from != "" || to != "" {
+		return backfill(ctx, ingester, req, fromDate, toDate)
+	}
 
-		JsonResponse, err := io.ReadAll(res.Body)
+	var report ingest.Report
+	for _, day := range days {
+		dayReport, err := ingester.IngestDay(ctx, day)
+		report.Merge(dayReport)
+		//取得元に指定日のデータがない場合は404（取得元のエラーは詳細に含める）
+		if errors.Is(err, ingest.ErrNoData) {
+			return events.APIGatewayProxyResponse{}, problem.NotFound("%s: %v", day.Format("2006-01-02"), err)
+		}
 		if err != nil {
 			return events.APIGatewayProxyResponse{}, err
 		}
-		if len(JsonResponse) == 0 {
-			return events.APIGatewayProxyResponse{}, errNoJsonResponse
-		}
+	}
 
-		//https://budougumi0617.github.io/2019/02/24/go-print-detail-of-json-syntax-error/
-		var infectionStatusTmp InfectionStatusTmp
-		if err = json.Unmarshal(JsonResponse, &infectionStatusTmp); err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(bytes),
+	}, nil
+}
 
-		var infectionStatusList []InfectionStatus
-		for _, item := range infectionStatusTmp.ItemList {
-			var infectionStatus InfectionStatus
-
-			//都道府県
-			infectionStatus.Prefecture = item.NameJp
-
-			//日付
-			layout := "2006-01-02"
-			t, err := time.Parse(layout, item.Date)
-			if err != nil {
-				return events.APIGatewayProxyResponse{}, err
-			}
-			infectionStatus.Date = t
-
-			//累積 感染者数
-			cumulative, err := strconv.Atoi(item.NPatients)
-			if err != nil {
-				return events.APIGatewayProxyResponse{}, err
-			}
-			infectionStatus.InfectionNumberCumulatively = cumulative
-
-			//日次 感染者数
-			//date型
-			day, err := time.Parse("20060102", val)
-			daybefore := day.AddDate(0, 0, -1)
-			if err != nil {
-				return events.APIGatewayProxyResponse{}, err
-			}
-
-			//select
-			rows, err := db.Query("SELECT infection_number_cumulatively FROM infection_status WHERE date = ? AND prefecture = ?", daybefore, infectionStatus.Prefecture)
-			if err != nil {
-				return events.APIGatewayProxyResponse{}, err
-			}
-			defer rows.Close()
-
-			array := make([]int, 0)
-			for rows.Next() {
-				var i int
-				err := rows.Scan(&i)
-				if err != nil {
-					return events.APIGatewayProxyResponse{}, err
-				}
-				array = append(array, i)
-			}
-
-			//累積と比較
-			var ans int
-			if len(array) == 0 {
-				ans = 0
-			} else {
-				ans = infectionStatus.InfectionNumberCumulatively - array[0]
-			}
-			infectionStatus.InfectionNumberDaily = ans
-
-			infectionStatusList = append(infectionStatusList, infectionStatus)
-		}
+func parseRange(from, to string) (time.Time, time.Time, error) {
+	if from == "" || to == "" {
+		return time.Time{}, time.Time{}, problem.BadRequest("both from and to are required")
+	}
+	fromDate, err := time.Parse(ingest.DateLayout, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, problem.BadRequest("invalid from: %s", from)
+	}
+	toDate, err := time.Parse(ingest.DateLayout, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, problem.BadRequest("invalid to: %s", to)
+	}
+	if toDate.Before(fromDate) {
+		return time.Time{}, time.Time{}, problem.BadRequest("from %s is after to %s", from, to)
+	}
+	return fromDate, toDate, nil
+}
 
-		insert, err := db.Prepare(fmt.Sprintf("INSERT INTO %s (date, prefecture, infection_number_daily, infection_number_cumulatively) VALUES (?, ?, ?, ?)", "infection_status"))
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
+// API Gatewayのタイムアウト（29秒）前に中断し、途中までの結果を返す
+const backfillBudget = 25 * time.Second
 
-		for _, val := range infectionStatusList {
-			res, err := insert.Exec(val.Date, val.Prefecture, val.InfectionNumberDaily, val.InfectionNumberCumulatively)
-			if err != nil {
-				return events.APIGatewayProxyResponse{}, err
-			}
-
-			rowsAffected, err := res.RowsAffected()
-			if err != nil {
-				return events.APIGatewayProxyResponse{}, err
-			}
-			rowsAffectedSum += rowsAffected
-		}
-		bytes, err := json.Marshal(infectionStatusList)
-		if err != nil {
+// from〜toの期間を日付順に登録する。中断した場合は同じ期間で再実行すると続きから再開する
+func backfill(ctx context.Context, ingester ingest.Ingester, req events.APIGatewayProxyRequest, fromDate, toDate time.Time) (events.APIGatewayProxyResponse, error) {
+	workers, _ := strconv.Atoi(os.Getenv("BACKFILL_WORKERS"))
+	b := ingest.Backfill{Ingester: ingester, Workers: workers, Budget: backfillBudget}
+	if req.QueryStringParameters["restart"] == "true" {
+		if err := b.Reset(ctx, fromDate, toDate); err != nil {
 			return events.APIGatewayProxyResponse{}, err
 		}
-		fmt.Printf("Body Size : %d Byte \n", len(bytes))
 	}
 
-	body := fmt.Sprintf("Inserted %d rows.\n", rowsAffectedSum)
+	result, err := b.Run(ctx, fromDate, toDate)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	//completedがfalseの場合は同じfrom/toで再実行すると続きから再開する
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
-		Body:       body,
+		Body:       string(bytes),
 	}, nil
 }
 
+// 前日欠損の補完で遡る日数
+func maxLookback() int {
+	n, _ := strconv.Atoi(os.Getenv("MAX_LOOKBACK"))
+	return n
+}
+
 func main() {
-	lambda.Start(handler)
+	lambda.Start(problem.Wrap(handler))
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+)
+
+func TestHandler(t *testing.T) {
+	//取得元のエラーはDBに接続する前に返る
+	openDB = func() (*sql.DB, error) {
+		return sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/test?parseTime=true")
+	}
+	t.Setenv("ARCHIVE", "")
+	t.Setenv("SOURCE", "csv")
+	t.Setenv("CSV_SOURCE", "../internal/ingest/testdata/newly_confirmed_cases_daily.csv")
+
+	//接続できない取得元
+	ts := httptest.NewServer(http.NotFoundHandler())
+	unreachable := ts.URL
+	ts.Close()
+
+	tests := []struct {
+		name       string
+		csvSource  string
+		req        events.APIGatewayProxyRequest
+		wantStatus int
+	}{
+		{
+			name: "no data for the date",
+			req: events.APIGatewayProxyRequest{
+				MultiValueQueryStringParameters: map[string][]string{"date": {"20230110"}},
+			},
+			wantStatus: 404,
+		},
+		{
+			name: "invalid date",
+			req: events.APIGatewayProxyRequest{
+				MultiValueQueryStringParameters: map[string][]string{"date": {"2023-01-10"}},
+			},
+			wantStatus: 400,
+		},
+		{
+			name: "inverted range",
+			req: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"from": "20230105", "to": "20230101"},
+			},
+			wantStatus: 400,
+		},
+		{
+			name:      "unreachable source",
+			csvSource: unreachable,
+			req: events.APIGatewayProxyRequest{
+				MultiValueQueryStringParameters: map[string][]string{"date": {"20230101"}},
+			},
+			wantStatus: 502,
+		},
+		{
+			name: "replay without archive",
+			req: events.APIGatewayProxyRequest{
+				QueryStringParameters:           map[string]string{"replay": "true"},
+				MultiValueQueryStringParameters: map[string][]string{"date": {"20230101"}},
+			},
+			wantStatus: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.csvSource != "" {
+				t.Setenv("CSV_SOURCE", tt.csvSource)
+			}
+			res, err := problem.Wrap(handler)(context.Background(), tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d: %s", res.StatusCode, tt.wantStatus, res.Body)
+			}
+		})
+	}
+}
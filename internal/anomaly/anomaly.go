@@ -0,0 +1,87 @@
+// 日次感染者数の異常値（累積感染者数の下方修正による負の値、一括計上による急増）の検出
+package anomaly
+
+import (
+	"math"
+	"sort"
+)
+
+// 検出理由
+type Reason string
+
+const (
+	// 累積感染者数が前日より減少した（日次感染者数が負）
+	Negative Reason = "negative"
+	// 直近の履歴に対するロバストZスコアが閾値を超えて増加した
+	Outlier Reason = "outlier"
+)
+
+const (
+	// 比較に使う直近の日数
+	Window = 28
+	// ロバストZスコアの算出に必要な履歴の日数（欠損日を除く）
+	MinHistory = 14
+	// ロバストZスコアの閾値（Iglewicz & Hoaglin）
+	Threshold = 3.5
+)
+
+// 正規分布の場合にMADを標準偏差に換算する係数
+const madScale = 1.4826
+
+// Expectedは直近の履歴の中央値（置き換え用の値）、Scoreはロバストスコア
+// 履歴が足りない場合のExpected・ScoreはNaN
+type Flag struct {
+	Reason   Reason
+	Expected float64
+	Score    float64
+}
+
+// 直前までの日次感染者数（古い順、欠損はNaN、直近Window日分を使う）に対してvalueを判定する
+// 負の値は履歴によらず検出し、それ以外は (value - 中央値) / (1.4826 * MAD) が閾値を超える場合に検出する
+// 曜日による減少（月曜日など）と区別できないため、急減は検出しない
+// 件数のばらつきはポアソン分布より小さくならないため、尺度の下限は √中央値（最小1）とする
+func Check(history []float64, value float64) (Flag, bool) {
+	flag := Flag{Expected: math.NaN(), Score: math.NaN()}
+	if len(history) > Window {
+		history = history[len(history)-Window:]
+	}
+	var values []float64
+	for _, v := range history {
+		if !math.IsNaN(v) {
+			values = append(values, v)
+		}
+	}
+	if len(values) >= MinHistory {
+		median := Median(values)
+		deviations := make([]float64, len(values))
+		for i, v := range values {
+			deviations[i] = math.Abs(v - median)
+		}
+		scale := math.Max(madScale*Median(deviations), math.Sqrt(math.Max(median, 1)))
+		flag.Expected = median
+		flag.Score = (value - median) / scale
+	}
+
+	switch {
+	case value < 0:
+		flag.Reason = Negative
+	case flag.Score > Threshold:
+		flag.Reason = Outlier
+	default:
+		return flag, false
+	}
+	return flag, true
+}
+
+func Median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n == 0 {
+		return math.NaN()
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
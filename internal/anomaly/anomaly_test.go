@@ -0,0 +1,102 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+)
+
+// 曜日による変動のある履歴
+func history(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = []float64{100, 60, 110, 120, 115, 105, 100}[i%7]
+	}
+	return values
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		history    []float64
+		value      float64
+		want       bool
+		wantReason Reason
+	}{
+		{
+			name:    "usual value",
+			history: history(28),
+			value:   118,
+		},
+		{
+			name:    "weekday low",
+			history: history(28),
+			value:   60,
+		},
+		{
+			name:       "spike",
+			history:    history(28),
+			value:      900,
+			want:       true,
+			wantReason: Outlier,
+		},
+		{
+			name:       "negative",
+			history:    history(28),
+			value:      -30,
+			want:       true,
+			wantReason: Negative,
+		},
+		{
+			name:       "negative without history",
+			value:      -1,
+			want:       true,
+			wantReason: Negative,
+		},
+		{
+			name:    "spike without enough history",
+			history: history(MinHistory - 1),
+			value:   900,
+		},
+		{
+			name:    "small counts",
+			history: make([]float64, 28),
+			value:   3,
+		},
+		{
+			name:       "spike after zeros",
+			history:    make([]float64, 28),
+			value:      10,
+			want:       true,
+			wantReason: Outlier,
+		},
+		{
+			//ウィンドウより前の値は使わない
+			name:    "older history ignored",
+			history: append(make([]float64, 28), history(28)...),
+			value:   118,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Check(tt.history, tt.value)
+			if ok != tt.want || got.Reason != tt.wantReason {
+				t.Errorf("Check() = %+v, %v, want %v, %v", got, ok, tt.wantReason, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExpected(t *testing.T) {
+	h := history(28)
+	//欠損日は除く
+	h[3] = math.NaN()
+	got, ok := Check(h, 900)
+	if !ok || got.Expected != 105 || !(got.Score > Threshold) {
+		t.Errorf("Check() = %+v, %v", got, ok)
+	}
+
+	got, _ = Check(nil, -1)
+	if !math.IsNaN(got.Expected) || !math.IsNaN(got.Score) {
+		t.Errorf("Check() = %+v, want NaN expected and score", got)
+	}
+}
@@ -0,0 +1,175 @@
+// 取得元APIのレスポンスの保存と再生
+// 保存したレスポンスを使って、ネットワークに接続せずに登録処理を再実行できる
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("archived payload not found")
+
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// prefixで始まるキーを昇順で返す
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// 保存するレスポンス
+type Payload struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	SHA256    string    `json:"sha256"`
+	Body      []byte    `json:"body"`
+}
+
+func NewPayload(u string, fetchedAt time.Time, body []byte) Payload {
+	sum := sha256.Sum256(body)
+	return Payload{
+		URL:       u,
+		FetchedAt: fetchedAt.UTC(),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Body:      body,
+	}
+}
+
+// 同じリクエストのレスポンスは同じプレフィックスに取得時刻順で保存する
+// 例: covid19japanall/date=20230101/20230102T023000.000000000Z-1a2b3c4d5e6f.json
+func Prefix(u *url.URL) string {
+	query := u.Query().Encode()
+	if query == "" {
+		query = "_"
+	}
+	return strings.ToLower(path.Base(u.Path)) + "/" + query + "/"
+}
+
+func Key(u *url.URL, p Payload) string {
+	return Prefix(u) + p.FetchedAt.Format("20060102T150405.000000000Z") + "-" + p.SHA256[:12] + ".json"
+}
+
+func Save(ctx context.Context, store Store, u *url.URL, p Payload) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, Key(u, p), data)
+}
+
+// 最後に取得したレスポンスを返す
+func Latest(ctx context.Context, store Store, u *url.URL) (Payload, error) {
+	var p Payload
+	keys, err := store.List(ctx, Prefix(u))
+	if err != nil {
+		return p, err
+	}
+	if len(keys) == 0 {
+		return p, fmt.Errorf("%w: %s", ErrNotFound, u)
+	}
+	sort.Strings(keys)
+
+	data, err := store.Get(ctx, keys[len(keys)-1])
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
+
+// 200のレスポンスを保存するTransport
+type recordingTransport struct {
+	base  http.RoundTripper
+	store Store
+	now   func() time.Time
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := Save(req.Context(), t.store, req.URL, NewPayload(req.URL.String(), t.now(), body)); err != nil {
+		return nil, fmt.Errorf("archive %s: %w", req.URL, err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+// 保存済みのレスポンスを返すTransport。保存されていない場合は404を返す
+type replayTransport struct {
+	store Store
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, err := Latest(req.Context(), t.store, req.URL)
+	status := http.StatusOK
+	if errors.Is(err, ErrNotFound) {
+		status = http.StatusNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(p.Body)),
+		ContentLength: int64(len(p.Body)),
+		Request:       req,
+	}, nil
+}
+
+// replayがfalseの場合は取得したレスポンスを保存し、trueの場合は保存済みのレスポンスを返す
+func Transport(store Store, replay bool) http.RoundTripper {
+	if replay {
+		return &replayTransport{store: store}
+	}
+	return &recordingTransport{base: http.DefaultTransport, store: store, now: time.Now}
+}
+
+// 環境変数 ARCHIVE から保存先を作成する。未設定の場合はnil
+//
+//	file:///tmp/archive    ローカルファイル
+//	s3://bucket/prefix     S3互換ストレージ（MinIO等は ARCHIVE_S3_ENDPOINT でエンドポイントを指定）
+func FromEnv(ctx context.Context) (Store, error) {
+	return Open(ctx, os.Getenv("ARCHIVE"))
+}
+
+func Open(ctx context.Context, rawurl string) (Store, error) {
+	if rawurl == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file", "":
+		return NewFileStore(u.Path), nil
+	case "s3":
+		return NewS3Store(ctx, u.Host, strings.TrimPrefix(u.Path, "/"), os.Getenv("ARCHIVE_S3_ENDPOINT"))
+	default:
+		return nil, fmt.Errorf("unsupported archive scheme: %s", u.Scheme)
+	}
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"call":%d}`, calls)
+	}))
+	defer ts.Close()
+
+	store := NewFileStore(t.TempDir())
+	recording := &http.Client{Transport: Transport(store, false)}
+	for i := 0; i < 2; i++ {
+		res, err := recording.Get(ts.URL + "/api/Covid19JapanAll?date=20230101")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+
+	keys, err := store.List(context.Background(), "covid19japanall/date=20230101/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("keys = %v, want 2 keys", keys)
+	}
+
+	replay := &http.Client{Transport: Transport(store, true)}
+	t.Run("Latest payload", func(t *testing.T) {
+		res, err := replay.Get("https://opendata.corona.go.jp/api/Covid19JapanAll?date=20230101")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != 200 || string(body) != `{"call":2}` {
+			t.Errorf("replay = %d %s, want 200 {\"call\":2}", res.StatusCode, body)
+		}
+	})
+
+	t.Run("Not archived", func(t *testing.T) {
+		res, err := replay.Get("https://opendata.corona.go.jp/api/Covid19JapanAll?date=20230102")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 404 {
+			t.Errorf("replay status = %d, want 404", res.StatusCode)
+		}
+	})
+
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	p, err := Latest(context.Background(), NewFileStore(t.TempDir()), mustParse(t, "https://example.com/api/x"))
+	if err == nil {
+		t.Fatalf("Latest() = %v, want ErrNotFound", p)
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestFileStoreList(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	for _, key := range []string{
+		"covid19japanall/date=20230101/1.json",
+		"covid19japanall/date=20230101/2.json",
+		"covid19japanall/date=20230102/1.json",
+		"other/date=20230101/1.json",
+	} {
+		if err := store.Put(context.Background(), key, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   int
+	}{
+		{"covid19japanall/date=20230101/", 2},
+		{"covid19japanall/date=2023010", 3},
+		{"covid19japanall/date=20230103/", 0},
+		{"", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			keys, err := store.List(context.Background(), tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != tt.want {
+				t.Errorf("List() = %v, want %d keys", keys, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// 日本時間の時計
+// Lambdaの実行環境はUTCのため、日付の計算はすべてこの時計を通して日本時間で行う
+package clock
+
+import (
+	"time"
+	_ "time/tzdata"
+)
+
+var Tokyo = func() *time.Location {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
+}()
+
+type Clock interface {
+	Now() time.Time
+}
+
+// 現在時刻
+type System struct{}
+
+func (System) Now() time.Time {
+	return time.Now().In(Tokyo)
+}
+
+// テスト用の固定時刻
+type Fixed time.Time
+
+func (f Fixed) Now() time.Time {
+	return time.Time(f).In(Tokyo)
+}
+
+// 日本時間の日付。DBのDATE型と同じくUTCの0時で表す
+func Date(t time.Time) time.Time {
+	y, m, d := t.In(Tokyo).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// 日本時間の今日
+func Today(c Clock) time.Time {
+	return Date(c.Now())
+}
+
+// 日本時間の今日からn日前
+func DaysAgo(c Clock, n int) time.Time {
+	return Today(c).AddDate(0, 0, -n)
+}
@@ -0,0 +1,44 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToday(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "UTC morning is same day in Tokyo",
+			now:  time.Date(2023, 1, 1, 2, 30, 0, 0, time.UTC),
+			want: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "UTC 15:00 is next day in Tokyo",
+			now:  time.Date(2023, 1, 1, 15, 0, 0, 0, time.UTC),
+			want: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "year boundary",
+			now:  time.Date(2022, 12, 31, 16, 0, 0, 0, time.UTC),
+			want: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Fixed(tt.now)
+			if got := Today(c); !got.Equal(tt.want) {
+				t.Errorf("Today() = %v, want %v", got, tt.want)
+			}
+			if got := DaysAgo(c, 1); !got.Equal(tt.want.AddDate(0, 0, -1)) {
+				t.Errorf("DaysAgo(1) = %v, want %v", got, tt.want.AddDate(0, 0, -1))
+			}
+			if got := c.Now(); got.Location() != Tokyo || !got.Equal(tt.now) {
+				t.Errorf("Now() = %v, want %v in Tokyo", got, tt.now)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// データベース操作の共通処理
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// MySQLのプレースホルダ上限(65535)に収まる行数
+const DefaultChunkSize = 500
+
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// fnをトランザクション内で実行し、エラーの場合はロールバックする
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 複数行INSERTをchunkSize行ごとに実行し、影響行数の合計を返す
+// insert は "INSERT INTO table (a, b)" まで、suffix は "ON DUPLICATE KEY UPDATE ..." など
+func BulkInsert(ctx context.Context, exec Execer, insert, suffix string, rows [][]interface{}, chunkSize int) (int64, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	var rowsAffectedSum int64
+	for start := 0; start < len(rows); start += chunkSize {
+		end := start + chunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunk := rows[start:end]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*len(chunk[0]))
+		for i, row := range chunk {
+			placeholders[i] = "(" + strings.TrimSuffix(strings.Repeat("?, ", len(row)), ", ") + ")"
+			args = append(args, row...)
+		}
+
+		query := insert + " VALUES " + strings.Join(placeholders, ", ")
+		if suffix != "" {
+			query += " " + suffix
+		}
+		res, err := exec.ExecContext(ctx, query, args...)
+		if err != nil {
+			return rowsAffectedSum, err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return rowsAffectedSum, err
+		}
+		rowsAffectedSum += rowsAffected
+	}
+	return rowsAffectedSum, nil
+}
@@ -0,0 +1,59 @@
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+type fakeExecer struct {
+	queries []string
+	args    [][]interface{}
+}
+
+func (f *fakeExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, args)
+	return fakeResult(len(args) / 2), nil
+}
+
+func TestBulkInsert(t *testing.T) {
+	rows := [][]interface{}{{1, "a"}, {2, "b"}, {3, "c"}}
+	exec := &fakeExecer{}
+
+	got, err := BulkInsert(context.Background(), exec, "INSERT INTO t (id, name)", "ON DUPLICATE KEY UPDATE name = VALUES(name)", rows, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 3 {
+		t.Errorf("BulkInsert() = %d, want 3", got)
+	}
+
+	wantQueries := []string{
+		"INSERT INTO t (id, name) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE name = VALUES(name)",
+		"INSERT INTO t (id, name) VALUES (?, ?) ON DUPLICATE KEY UPDATE name = VALUES(name)",
+	}
+	if !reflect.DeepEqual(exec.queries, wantQueries) {
+		t.Errorf("queries = %v, want %v", exec.queries, wantQueries)
+	}
+	wantArgs := [][]interface{}{{1, "a", 2, "b"}, {3, "c"}}
+	if !reflect.DeepEqual(exec.args, wantArgs) {
+		t.Errorf("args = %v, want %v", exec.args, wantArgs)
+	}
+}
+
+func TestBulkInsertEmpty(t *testing.T) {
+	exec := &fakeExecer{}
+	if _, err := BulkInsert(context.Background(), exec, "INSERT INTO t (id)", "", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(exec.queries) != 0 {
+		t.Errorf("queries = %v, want none", exec.queries)
+	}
+}
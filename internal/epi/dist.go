@@ -0,0 +1,166 @@
+package epi
+
+import "math"
+
+const (
+	eps      = 1e-14
+	tiny     = 1e-300
+	maxIter  = 500
+	bisectN  = 200
+	bisectTo = 1e-12
+)
+
+// 正則化下側不完全ガンマ関数 P(a, x)
+func gammaP(a, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	lg, _ := math.Lgamma(a)
+	front := math.Exp(-x + a*math.Log(x) - lg)
+	if x < a+1 {
+		//級数展開
+		ap, del := a, 1/a
+		sum := del
+		for i := 0; i < maxIter; i++ {
+			ap++
+			del *= x / ap
+			sum += del
+			if math.Abs(del) < math.Abs(sum)*eps {
+				break
+			}
+		}
+		return sum * front
+	}
+
+	//連分数展開（Lentz法）
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < maxIter; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return 1 - front*h
+}
+
+// ガンマ分布（形状shape、尺度scale）の累積分布関数
+func gammaCDF(x, shape, scale float64) float64 {
+	return gammaP(shape, x/scale)
+}
+
+// ガンマ分布のp分位点（二分法）
+func gammaQuantile(p, shape, scale float64) float64 {
+	hi := shape * scale
+	for gammaCDF(hi, shape, scale) < p {
+		hi *= 2
+	}
+	return bisect(0, hi, func(x float64) bool { return gammaCDF(x, shape, scale) < p })
+}
+
+// 正則化不完全ベータ関数 I_x(a, b)
+func betaInc(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lab, _ := math.Lgamma(a + b)
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaCF(a, b, x) / a
+	}
+	return 1 - front*betaCF(b, a, 1-x)/b
+}
+
+// 不完全ベータ関数の連分数展開
+func betaCF(a, b, x float64) float64 {
+	qab, qap, qam := a+b, a+1, a-1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m < maxIter; m++ {
+		fm := float64(m)
+		m2 := 2 * fm
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
+
+// 自由度dfのt分布の累積分布関数
+func studentTCDF(t, df float64) float64 {
+	tail := 0.5 * betaInc(df/2, 0.5, df/(df+t*t))
+	if t >= 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// 自由度dfのt分布のp分位点（p >= 0.5、二分法）
+func studentTQuantile(p, df float64) float64 {
+	hi := 1.0
+	for studentTCDF(hi, df) < p {
+		hi *= 2
+	}
+	return bisect(0, hi, func(x float64) bool { return studentTCDF(x, df) < p })
+}
+
+// below(x)がtrueとなる範囲の上端を[lo, hi]から求める
+func bisect(lo, hi float64, below func(float64) bool) float64 {
+	for i := 0; i < bisectN && hi-lo > bisectTo*math.Max(1, hi); i++ {
+		mid := (lo + hi) / 2
+		if below(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
@@ -0,0 +1,171 @@
+// 日次感染者数からの疫学指標の推定
+// 実効再生産数（Cori et al. 2013）と、対数線形回帰による増加率・倍加時間
+package epi
+
+import (
+	"errors"
+	"math"
+)
+
+// 発症間隔の分布（ガンマ分布）の平均と標準偏差（日）
+type SerialInterval struct {
+	Mean float64 `json:"mean"`
+	SD   float64 `json:"sd"`
+}
+
+// 既定の発症間隔（Nishiura et al. 2020）
+var DefaultSerialInterval = SerialInterval{Mean: 4.7, SD: 2.9}
+
+// 離散化で打ち切る累積確率
+const siCoverage = 0.999
+
+// 事前分布 Gamma(shape=1, scale=5)（EpiEstimの既定値）
+const (
+	priorShape = 1.0
+	priorScale = 5.0
+)
+
+var ErrInvalidSerialInterval = errors.New("invalid serial interval")
+
+func (s SerialInterval) Validate() error {
+	if !(s.Mean > 0) || !(s.SD > 0) || math.IsInf(s.Mean, 0) || math.IsInf(s.SD, 0) {
+		return ErrInvalidSerialInterval
+	}
+	return nil
+}
+
+// 離散化した発症間隔の重み。w[k]はk日後に二次感染が発症する確率（w[0] = 0）
+// 累積確率がsiCoverageに達するまでの区間 (k-1, k] の確率を合計1に正規化する
+func (s SerialInterval) Weights() []float64 {
+	shape := s.Mean * s.Mean / (s.SD * s.SD)
+	scale := s.SD * s.SD / s.Mean
+
+	w := []float64{0}
+	var sum, prev float64
+	for k := 1; prev < siCoverage; k++ {
+		cdf := gammaCDF(float64(k), shape, scale)
+		w = append(w, cdf-prev)
+		sum += cdf - prev
+		prev = cdf
+	}
+	for k := range w {
+		w[k] /= sum
+	}
+	return w
+}
+
+// 実効再生産数の推定値と信用区間
+type Rt struct {
+	Index int
+	Mean  float64
+	Lower float64
+	Upper float64
+}
+
+// 感染力 Λ_t = Σ I_{t-k} w_k
+func infectivity(incidence, w []float64, t int) float64 {
+	var sum float64
+	for k := 1; k < len(w) && k <= t; k++ {
+		sum += incidence[t-k] * w[k]
+	}
+	return sum
+}
+
+// 直近window日間の発症数から各時点の実効再生産数を推定する
+// 事後分布 Gamma(a + ΣI, 1/(1/b + ΣΛ)) の平均と、level（0.95など）の信用区間を返す
+// 感染力が0の時点は推定できないため含めない
+func EstimateRt(incidence []float64, si SerialInterval, window int, level float64) []Rt {
+	w := si.Weights()
+	lambda := make([]float64, len(incidence))
+	for t := range incidence {
+		lambda[t] = infectivity(incidence, w, t)
+	}
+
+	var list []Rt
+	for t := window; t < len(incidence); t++ {
+		var sumI, sumLambda float64
+		for s := t - window + 1; s <= t; s++ {
+			sumI += incidence[s]
+			sumLambda += lambda[s]
+		}
+		if sumLambda <= 0 {
+			continue
+		}
+		shape := priorShape + sumI
+		scale := 1 / (1/priorScale + sumLambda)
+		alpha := (1 - level) / 2
+		list = append(list, Rt{
+			Index: t,
+			Mean:  shape * scale,
+			Lower: gammaQuantile(alpha, shape, scale),
+			Upper: gammaQuantile(1-alpha, shape, scale),
+		})
+	}
+	return list
+}
+
+// 1日あたりの増加率（指数増加率）と信頼区間
+type Growth struct {
+	Rate  float64
+	Lower float64
+	Upper float64
+}
+
+// log(I_t) = α + r t の最小二乗法で増加率rを推定する
+// 0以下の日は除き、3日未満の場合はfalse
+func EstimateGrowth(incidence []float64, level float64) (Growth, bool) {
+	var xs, ys []float64
+	for t, val := range incidence {
+		if val > 0 {
+			xs = append(xs, float64(t))
+			ys = append(ys, math.Log(val))
+		}
+	}
+	n := float64(len(xs))
+	if len(xs) < 3 {
+		return Growth{}, false
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= n
+	meanY /= n
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	rate := sxy / sxx
+	var sse float64
+	for i := range xs {
+		res := ys[i] - (meanY + rate*(xs[i]-meanX))
+		sse += res * res
+	}
+	se := math.Sqrt(sse / (n - 2) / sxx)
+	q := studentTQuantile(1-(1-level)/2, n-2)
+	return Growth{Rate: rate, Lower: rate - q*se, Upper: rate + q*se}, true
+}
+
+// 増加率に対応する倍加時間（日）。減少している場合は負の値（半減期間）
+// 増加率が0の場合は無限大
+func DoublingTime(rate float64) float64 {
+	if rate == 0 {
+		return math.Inf(1)
+	}
+	return math.Ln2 / rate
+}
+
+// 倍加時間の区間。増加率の区間が0をまたぐ場合は求められないためfalse
+func (g Growth) DoublingTime() (lower, upper float64, ok bool) {
+	if g.Lower <= 0 && g.Upper >= 0 {
+		return 0, 0, false
+	}
+	lower, upper = DoublingTime(g.Upper), DoublingTime(g.Lower)
+	if lower > upper {
+		lower, upper = upper, lower
+	}
+	return lower, upper, true
+}
@@ -0,0 +1,156 @@
+package epi
+
+import (
+	"math"
+	"testing"
+)
+
+func near(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol
+}
+
+func TestDist(t *testing.T) {
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"exponential cdf", gammaCDF(2, 1, 1), 1 - math.Exp(-2)},
+		{"gamma cdf large x", gammaCDF(30, 4, 2), 1 - math.Exp(-15)*(1+15+112.5+562.5)},
+		{"gamma median", gammaQuantile(0.5, 1, 2), 2 * math.Ln2},
+		{"gamma quantile", gammaQuantile(0.975, 10, 1), 17.084803},
+		{"t cdf", studentTCDF(0, 5), 0.5},
+		{"t quantile", studentTQuantile(0.975, 10), 2.228139},
+		{"t quantile df1", studentTQuantile(0.975, 1), 12.706205},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !near(tt.got, tt.want, 1e-6) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeights(t *testing.T) {
+	w := DefaultSerialInterval.Weights()
+	if w[0] != 0 {
+		t.Errorf("w[0] = %v, want 0", w[0])
+	}
+	var sum, mean float64
+	for k, val := range w {
+		sum += val
+		mean += float64(k) * val
+	}
+	if !near(sum, 1, 1e-9) {
+		t.Errorf("sum = %v, want 1", sum)
+	}
+	//区間 (k-1, k] を k とするため、平均は連続分布より0.5日程度大きい
+	if !near(mean, DefaultSerialInterval.Mean+0.5, 0.1) {
+		t.Errorf("mean = %v, want about %v", mean, DefaultSerialInterval.Mean+0.5)
+	}
+
+	if err := (SerialInterval{Mean: 4.7}).Validate(); err == nil {
+		t.Error("Validate() error = nil, want error for sd 0")
+	}
+}
+
+// 再生産数Rの再生方程式 I_t = R Λ_t に従う系列
+func renewal(r float64, n int) []float64 {
+	w := DefaultSerialInterval.Weights()
+	incidence := make([]float64, n)
+	incidence[0] = 1000
+	for t := 1; t < n; t++ {
+		incidence[t] = r * infectivity(incidence, w, t)
+		if t < len(w) {
+			//初期は感染力が小さいため、一定数の流入を加える
+			incidence[t] += 1000
+		}
+	}
+	return incidence
+}
+
+func TestEstimateRt(t *testing.T) {
+	tests := []struct {
+		name string
+		r    float64
+	}{
+		{"growing", 1.5},
+		{"stable", 1.0},
+		{"declining", 0.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := EstimateRt(renewal(tt.r, 60), DefaultSerialInterval, 7, 0.95)
+			if len(list) == 0 {
+				t.Fatal("EstimateRt() returned no estimates")
+			}
+			last := list[len(list)-1]
+			if last.Index != 59 {
+				t.Errorf("Index = %d, want 59", last.Index)
+			}
+			if !near(last.Mean, tt.r, 0.01) {
+				t.Errorf("Mean = %v, want %v", last.Mean, tt.r)
+			}
+			if !(last.Lower < last.Mean && last.Mean < last.Upper) {
+				t.Errorf("interval = [%v, %v], mean %v", last.Lower, last.Upper, last.Mean)
+			}
+		})
+	}
+
+	//感染力が0の期間は推定しない
+	if list := EstimateRt(make([]float64, 20), DefaultSerialInterval, 7, 0.95); len(list) != 0 {
+		t.Errorf("EstimateRt() = %v, want none", list)
+	}
+
+	//少数の場合は区間が広い
+	small := EstimateRt([]float64{2, 3, 1, 2, 4, 2, 3, 2, 1, 3, 2, 2, 3, 1, 2}, DefaultSerialInterval, 7, 0.95)
+	large := EstimateRt(renewal(1.0, 15), DefaultSerialInterval, 7, 0.95)
+	if small[len(small)-1].Upper-small[len(small)-1].Lower <= large[len(large)-1].Upper-large[len(large)-1].Lower {
+		t.Error("interval for small counts should be wider")
+	}
+}
+
+func TestEstimateGrowth(t *testing.T) {
+	exact := make([]float64, 14)
+	noisy := make([]float64, 14)
+	for i := range exact {
+		exact[i] = 100 * math.Exp(0.1*float64(i))
+		//曜日による変動
+		noisy[i] = exact[i] * []float64{1.2, 1, 1, 0.9, 0.9, 1, 1}[i%7]
+	}
+
+	g, ok := EstimateGrowth(exact, 0.95)
+	if !ok || !near(g.Rate, 0.1, 1e-9) || !near(g.Lower, 0.1, 1e-6) || !near(g.Upper, 0.1, 1e-6) {
+		t.Errorf("EstimateGrowth() = %+v, %v", g, ok)
+	}
+	if got := DoublingTime(g.Rate); !near(got, 6.931, 0.001) {
+		t.Errorf("DoublingTime() = %v", got)
+	}
+
+	g, ok = EstimateGrowth(noisy, 0.95)
+	if !ok || !near(g.Rate, 0.1, 0.01) || !(g.Lower < g.Rate && g.Rate < g.Upper) {
+		t.Errorf("EstimateGrowth() = %+v, %v", g, ok)
+	}
+	lower, upper, ok := g.DoublingTime()
+	if !ok || !(lower < DoublingTime(g.Rate) && DoublingTime(g.Rate) < upper) {
+		t.Errorf("Growth.DoublingTime() = %v, %v, %v", lower, upper, ok)
+	}
+
+	//減少は負の倍加時間（半減期間）
+	declining := make([]float64, 14)
+	for i := range declining {
+		declining[i] = 1000 * math.Exp(-0.05*float64(i))
+	}
+	if g, ok := EstimateGrowth(declining, 0.95); !ok || !near(DoublingTime(g.Rate), -13.863, 0.001) {
+		t.Errorf("EstimateGrowth() = %+v, %v", g, ok)
+	}
+
+	//横ばいの場合、倍加時間の区間は求められない
+	if _, _, ok := (Growth{Rate: 0.01, Lower: -0.02, Upper: 0.04}).DoublingTime(); ok {
+		t.Error("Growth.DoublingTime() ok = true, want false")
+	}
+	if _, ok := EstimateGrowth([]float64{0, 5, 0, 0}, 0.95); ok {
+		t.Error("EstimateGrowth() ok = true, want false")
+	}
+}
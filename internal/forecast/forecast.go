@@ -0,0 +1,206 @@
+// 日次感染者数の短期予測
+// log1p変換した系列に加法型Holt-Winters（週次の季節性）を当てはめる
+package forecast
+
+import (
+	"errors"
+	"math"
+)
+
+// 季節性の周期（曜日）
+const Season = 7
+
+// 平滑化パラメータ（水準、傾き、季節）
+type Params struct {
+	Alpha float64 `json:"alpha"`
+	Beta  float64 `json:"beta"`
+	Gamma float64 `json:"gamma"`
+}
+
+// パラメータの探索範囲。1期先予測誤差の二乗和が最小となる組み合わせを選ぶ
+var (
+	AlphaGrid = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+	BetaGrid  = []float64{0.01, 0.05, 0.1, 0.2}
+	GammaGrid = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+)
+
+var ErrTooShort = errors.New("series is too short")
+
+type Model struct {
+	Params Params
+	level  float64
+	trend  float64
+	// 次の時点から順に並べた季節成分
+	season []float64
+	// 1期先予測誤差の標準偏差（log1pの尺度）
+	sigma float64
+}
+
+// 予測値と予測区間（元の尺度）
+type Point struct {
+	Step  int
+	Mean  float64
+	Lower float64
+	Upper float64
+}
+
+func transform(y []float64) []float64 {
+	z := make([]float64, len(y))
+	for i, val := range y {
+		z[i] = math.Log1p(math.Max(0, val))
+	}
+	return z
+}
+
+// 当てはめの結果（最終時点の状態と1期先予測誤差の二乗和）
+type state struct {
+	level, trend float64
+	season       []float64
+	sse          float64
+}
+
+// 最初の2周期から初期値を決め、3周期目以降を平滑化する
+func smooth(z []float64, p Params) state {
+	var first, second float64
+	for i := 0; i < Season; i++ {
+		first += z[i]
+		second += z[Season+i]
+	}
+	first /= Season
+	second /= Season
+
+	s := state{level: first, trend: (second - first) / Season, season: make([]float64, Season)}
+	for i := 0; i < Season; i++ {
+		s.season[i] = z[i] - first
+	}
+	//初期値は1周期目の中央時点の水準のため、1周期目の末尾まで進める
+	s.level += s.trend * float64(Season-1) / 2
+	for t := Season; t < len(z); t++ {
+		seasonal := s.season[t%Season]
+		e := z[t] - (s.level + s.trend + seasonal)
+		if t >= 2*Season {
+			s.sse += e * e
+		}
+		prevLevel := s.level
+		s.level = p.Alpha*(z[t]-seasonal) + (1-p.Alpha)*(s.level+s.trend)
+		s.trend = p.Beta*(s.level-prevLevel) + (1-p.Beta)*s.trend
+		s.season[t%Season] = p.Gamma*(z[t]-s.level) + (1-p.Gamma)*seasonal
+	}
+	return s
+}
+
+// 日次感染者数の系列（古い順）にモデルを当てはめる。3周期以上必要
+func Fit(y []float64) (*Model, error) {
+	if len(y) < 3*Season {
+		return nil, ErrTooShort
+	}
+	z := transform(y)
+
+	var best *state
+	var bestParams Params
+	for _, alpha := range AlphaGrid {
+		for _, beta := range BetaGrid {
+			for _, gamma := range GammaGrid {
+				p := Params{Alpha: alpha, Beta: beta, Gamma: gamma}
+				s := smooth(z, p)
+				if best == nil || s.sse < best.sse {
+					best, bestParams = &s, p
+				}
+			}
+		}
+	}
+
+	n := len(z) - 2*Season
+	m := &Model{
+		Params: bestParams,
+		level:  best.level,
+		trend:  best.trend,
+		season: make([]float64, Season),
+		sigma:  math.Sqrt(best.sse / float64(n)),
+	}
+	for i := range m.season {
+		m.season[i] = best.season[(len(z)+i)%Season]
+	}
+	return m, nil
+}
+
+// h期先までの予測値と、水準level（0.95など）の予測区間
+// 区間の分散は σ²(1 + Σ c_j²)、c_j = α(1 + jβ) + γ(1 - α)[j mod 7 = 0]（Hyndman et al. 2008）
+func (m *Model) Forecast(h int, level float64) []Point {
+	q := math.Sqrt2 * math.Erfinv(level)
+	points := make([]Point, h)
+	var sumC2 float64
+	for k := 1; k <= h; k++ {
+		if j := k - 1; j > 0 {
+			c := m.Params.Alpha * (1 + float64(j)*m.Params.Beta)
+			if j%Season == 0 {
+				c += m.Params.Gamma * (1 - m.Params.Alpha)
+			}
+			sumC2 += c * c
+		}
+		mean := m.level + float64(k)*m.trend + m.season[(k-1)%Season]
+		width := q * m.sigma * math.Sqrt(1+sumC2)
+		points[k-1] = Point{
+			Step:  k,
+			Mean:  inverse(mean),
+			Lower: inverse(mean - width),
+			Upper: inverse(mean + width),
+		}
+	}
+	return points
+}
+
+func inverse(z float64) float64 {
+	return math.Max(0, math.Expm1(z))
+}
+
+// 過去の時点を起点に予測した場合の誤差
+// MAPEは実績が0の日を除き、該当がない場合はNaN
+// Coverageは実績が予測区間に入った割合
+type Backtest struct {
+	Horizon  int
+	Folds    int
+	MAE      float64
+	MAPE     float64
+	Coverage float64
+}
+
+// 系列の末尾からhorizon日ずつ遡った起点で当てはめと予測を繰り返す（最大folds回）
+func Evaluate(y []float64, horizon, folds int, level float64) (Backtest, error) {
+	b := Backtest{Horizon: horizon}
+	var absErr, pctErr float64
+	var n, nPct, covered int
+	for k := 1; k <= folds; k++ {
+		origin := len(y) - k*horizon
+		if origin < 3*Season {
+			break
+		}
+		m, err := Fit(y[:origin])
+		if err != nil {
+			return b, err
+		}
+		for i, p := range m.Forecast(horizon, level) {
+			actual := math.Max(0, y[origin+i])
+			absErr += math.Abs(p.Mean - actual)
+			if actual > 0 {
+				pctErr += math.Abs(p.Mean-actual) / actual
+				nPct++
+			}
+			if p.Lower <= actual && actual <= p.Upper {
+				covered++
+			}
+			n++
+		}
+		b.Folds++
+	}
+	if b.Folds == 0 {
+		return b, ErrTooShort
+	}
+	b.MAE = absErr / float64(n)
+	b.MAPE = math.NaN()
+	if nPct > 0 {
+		b.MAPE = pctErr / float64(nPct) * 100
+	}
+	b.Coverage = float64(covered) / float64(n)
+	return b, nil
+}
@@ -0,0 +1,102 @@
+package forecast
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// 曜日による変動を持つ系列
+var weekly = []float64{1.3, 1.1, 1.0, 0.9, 0.9, 0.8, 1.0}
+
+func series(n int, base, rate float64) []float64 {
+	y := make([]float64, n)
+	for t := range y {
+		y[t] = math.Round(base * math.Exp(rate*float64(t)) * weekly[t%Season])
+	}
+	return y
+}
+
+func TestFit(t *testing.T) {
+	if _, err := Fit(make([]float64, 3*Season-1)); !errors.Is(err, ErrTooShort) {
+		t.Errorf("Fit() error = %v, want ErrTooShort", err)
+	}
+
+	tests := []struct {
+		name string
+		rate float64
+	}{
+		{"stable", 0},
+		{"growing", 0.05},
+		{"declining", -0.03},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y := series(70, 1000, tt.rate)
+			m, err := Fit(y[:56])
+			if err != nil {
+				t.Fatal(err)
+			}
+			points := m.Forecast(14, 0.95)
+			if len(points) != 14 {
+				t.Fatalf("len(Forecast()) = %d, want 14", len(points))
+			}
+			for i, p := range points {
+				actual := y[56+i]
+				if math.Abs(p.Mean-actual)/actual > 0.05 {
+					t.Errorf("step %d: Mean = %.1f, actual %.1f", p.Step, p.Mean, actual)
+				}
+				if !(p.Lower <= p.Mean && p.Mean <= p.Upper) {
+					t.Errorf("step %d: interval [%.1f, %.1f], mean %.1f", p.Step, p.Lower, p.Upper, p.Mean)
+				}
+			}
+			//先の予測ほど区間が広い
+			if first, last := points[0], points[13]; first.Upper/first.Lower > last.Upper/last.Lower {
+				t.Errorf("interval should widen: %+v, %+v", first, last)
+			}
+		})
+	}
+}
+
+func TestForecastNonNegative(t *testing.T) {
+	y := make([]float64, 28)
+	for i := range y {
+		y[i] = float64(i % 2)
+	}
+	m, err := Fit(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range m.Forecast(7, 0.95) {
+		if p.Lower < 0 || p.Mean < 0 {
+			t.Errorf("Forecast() = %+v, want non-negative", p)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	b, err := Evaluate(series(56, 1000, 0.02), 7, 4, 0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Folds != 4 || b.Horizon != 7 {
+		t.Errorf("Evaluate() = %+v", b)
+	}
+	if b.MAPE > 5 || b.MAE <= 0 || b.Coverage < 0.5 {
+		t.Errorf("MAPE = %v, MAE = %v", b.MAPE, b.MAE)
+	}
+
+	//起点が3周期未満になる回は行わない
+	b, err = Evaluate(series(35, 1000, 0), 7, 4, 0.95)
+	if err != nil || b.Folds != 2 {
+		t.Errorf("Evaluate() = %+v, %v, want 2 folds", b, err)
+	}
+	if _, err := Evaluate(series(21, 1000, 0), 7, 4, 0.95); !errors.Is(err, ErrTooShort) {
+		t.Errorf("Evaluate() error = %v, want ErrTooShort", err)
+	}
+
+	//実績がすべて0の場合、MAPEは算出しない
+	if b, err := Evaluate(make([]float64, 28), 7, 1, 0.95); err != nil || !math.IsNaN(b.MAPE) || b.MAE != 0 {
+		t.Errorf("Evaluate() = %+v, %v", b, err)
+	}
+}
@@ -0,0 +1,98 @@
+// 参照系APIのHTTPキャッシュ（ETag・Cache-Control）
+// 感染者数は1日1回の取込でのみ更新されるため、次回の取込までブラウザ・CDNでキャッシュさせる
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// 取込の実行時刻（UTCの0時からの経過時間）
+// template.yaml の cron(30/20 2 * * ? *) と合わせる
+var Schedule = []time.Duration{
+	2*time.Hour + 30*time.Minute,
+	2*time.Hour + 50*time.Minute,
+}
+
+// 取込の完了を待つ余裕
+var Delay = 10 * time.Minute
+
+// bodyのSHA-256から作る強いETag
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// If-None-Matchがetagに一致するか（弱い比較）
+func Match(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// nowより後で、次に取込が反映される時刻
+func Expires(now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= 1; i++ {
+		for _, s := range Schedule {
+			if t := day.AddDate(0, 0, i).Add(s + Delay); t.After(now) {
+				return t
+			}
+		}
+	}
+	return now
+}
+
+// 次に取込が反映されるまでの秒数
+func MaxAge(now time.Time) int {
+	return int(Expires(now).Sub(now.UTC()) / time.Second)
+}
+
+// 200のレスポンスにETag・Cache-Controlを付ける
+// If-None-Matchが一致する場合は本文を返さず304とする
+func Apply(req events.APIGatewayProxyRequest, res events.APIGatewayProxyResponse, now time.Time) events.APIGatewayProxyResponse {
+	if res.StatusCode != 200 {
+		return res
+	}
+	headers := make(map[string]string, len(res.Headers)+3)
+	for k, v := range res.Headers {
+		headers[k] = v
+	}
+	etag := ETag([]byte(res.Body))
+	headers["ETag"] = etag
+	headers["Cache-Control"] = fmt.Sprintf("public, max-age=%d", MaxAge(now))
+	//Acceptヘッダーで出力形式が変わる
+	headers["Vary"] = "Accept"
+	res.Headers = headers
+
+	if ifNoneMatch := header(req, "If-None-Match"); ifNoneMatch != "" && Match(ifNoneMatch, etag) {
+		delete(res.Headers, "Content-Type")
+		res.StatusCode = 304
+		res.Body = ""
+	}
+	return res
+}
+
+func header(req events.APIGatewayProxyRequest, key string) string {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	for k, v := range req.MultiValueHeaders {
+		if strings.EqualFold(k, key) {
+			return strings.Join(v, ", ")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package httpcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestMatch(t *testing.T) {
+	etag := ETag([]byte("[]"))
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"same", etag, true},
+		{"list", `"abc", ` + etag, true},
+		{"weak", "W/" + etag, true},
+		{"any", "*", true},
+		{"other", `"abc"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.ifNoneMatch, etag); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpires(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"before first run", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 2, 40, 0, 0, time.UTC)},
+		{"between runs", time.Date(2023, 1, 1, 2, 40, 0, 0, time.UTC), time.Date(2023, 1, 1, 3, 0, 0, 0, time.UTC)},
+		{"after last run", time.Date(2023, 1, 1, 3, 0, 0, 0, time.UTC), time.Date(2023, 1, 2, 2, 40, 0, 0, time.UTC)},
+		{"jst", time.Date(2023, 1, 1, 20, 0, 0, 0, time.FixedZone("JST", 9*60*60)), time.Date(2023, 1, 2, 2, 40, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Expires(tt.now); !got.Equal(tt.want) {
+				t.Errorf("Expires() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := MaxAge(time.Date(2023, 1, 1, 2, 30, 0, 0, time.UTC)); got != 600 {
+		t.Errorf("MaxAge() = %d, want 600", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	now := time.Date(2023, 1, 1, 2, 30, 0, 0, time.UTC)
+	res := events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		Body:       "[]",
+	}
+
+	got := Apply(events.APIGatewayProxyRequest{}, res, now)
+	if got.StatusCode != 200 || got.Body != "[]" || got.Headers["ETag"] != ETag([]byte("[]")) || got.Headers["Cache-Control"] != "public, max-age=600" {
+		t.Fatalf("Apply() = %+v", got)
+	}
+	if _, ok := res.Headers["ETag"]; ok {
+		t.Error("Apply() modified the original headers")
+	}
+
+	req := events.APIGatewayProxyRequest{Headers: map[string]string{"if-none-match": got.Headers["ETag"]}}
+	got = Apply(req, res, now)
+	if got.StatusCode != 304 || got.Body != "" || got.Headers["ETag"] == "" {
+		t.Errorf("Apply() = %+v, want 304", got)
+	}
+
+	res.StatusCode = 400
+	if got := Apply(req, res, now); got.StatusCode != 400 || got.Headers["ETag"] != "" {
+		t.Errorf("Apply() = %+v, want unchanged", got)
+	}
+}
@@ -0,0 +1,102 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tsuvic/ca-geo-corona/internal/anomaly"
+	"github.com/tsuvic/ca-geo-corona/internal/dbutil"
+)
+
+// 登録時に検出した異常値
+type Anomaly struct {
+	Date                 time.Time
+	Prefecture           string
+	InfectionNumberDaily int
+	anomaly.Flag
+}
+
+// 登録する1日分の行を、直前anomaly.Window日間の登録済みの行（historyの前日以前の行）と比較して異常値を検出する
+func Detect(date time.Time, infectionStatusList, history []InfectionStatus) []Anomaly {
+	from := date.AddDate(0, 0, -anomaly.Window)
+	series := make(map[string][]float64)
+	for _, val := range history {
+		i := int(val.Date.Sub(from).Hours() / 24)
+		if i < 0 || i >= anomaly.Window {
+			continue
+		}
+		if series[val.Prefecture] == nil {
+			series[val.Prefecture] = make([]float64, anomaly.Window)
+			for j := range series[val.Prefecture] {
+				series[val.Prefecture][j] = math.NaN()
+			}
+		}
+		series[val.Prefecture][i] = float64(val.InfectionNumberDaily)
+	}
+
+	var anomalies []Anomaly
+	for _, val := range infectionStatusList {
+		if flag, ok := anomaly.Check(series[val.Prefecture], float64(val.InfectionNumberDaily)); ok {
+			anomalies = append(anomalies, Anomaly{Date: date, Prefecture: val.Prefecture, InfectionNumberDaily: val.InfectionNumberDaily, Flag: flag})
+		}
+	}
+	return anomalies
+}
+
+// 登録後の1日分の行の異常値を検出し、infection_status_anomaly の対象都道府県の行を置き換える
+func flagAnomalies(ctx context.Context, tx *sql.Tx, date time.Time, infectionStatusList []InfectionStatus, detectedAt time.Time) (int, error) {
+	history, err := recentDays(ctx, tx, date)
+	if err != nil {
+		return 0, err
+	}
+	anomalies := Detect(date, infectionStatusList, history)
+
+	placeholders := make([]string, len(infectionStatusList))
+	args := []interface{}{date}
+	for i, val := range infectionStatusList {
+		placeholders[i] = "?"
+		args = append(args, val.Prefecture)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM infection_status_anomaly WHERE date = ? AND prefecture IN ("+strings.Join(placeholders, ", ")+")", args...); err != nil {
+		return 0, err
+	}
+	if len(anomalies) == 0 {
+		return 0, nil
+	}
+
+	rows := make([][]interface{}, len(anomalies))
+	for i, a := range anomalies {
+		rows[i] = []interface{}{a.Date, a.Prefecture, string(a.Reason), a.InfectionNumberDaily, nullFloat(a.Expected), nullFloat(a.Score), detectedAt.UTC()}
+	}
+	_, err = dbutil.BulkInsert(ctx, tx,
+		"INSERT INTO infection_status_anomaly (date, prefecture, reason, infection_number_daily, expected, score, detected_at)",
+		"", rows, dbutil.DefaultChunkSize)
+	return len(anomalies), err
+}
+
+// 前日までの直近anomaly.Window日間の登録済みの行
+func recentDays(ctx context.Context, tx *sql.Tx, date time.Time) ([]InfectionStatus, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT date, prefecture, infection_number_daily FROM infection_status WHERE date >= ? AND date < ?", date.AddDate(0, 0, -anomaly.Window), date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []InfectionStatus
+	for rows.Next() {
+		var infectionStatus InfectionStatus
+		if err := rows.Scan(&infectionStatus.Date, &infectionStatus.Prefecture, &infectionStatus.InfectionNumberDaily); err != nil {
+			return nil, err
+		}
+		history = append(history, infectionStatus)
+	}
+	return history, rows.Err()
+}
+
+// NaNはNULL
+func nullFloat(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: f, Valid: !math.IsNaN(f)}
+}
@@ -0,0 +1,160 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultWorkers = 4
+
+// Lambdaのタイムアウト前に中断するための余裕
+const deadlineMargin = 30 * time.Second
+
+// 期間を指定した過去データの一括登録
+// 取得は並行に行い、登録は日次感染者数を直前に登録した前日分から算出するため日付順に行う
+// 登録済みの日付はチェックポイントテーブルに記録し、中断後に再実行すると続きから再開する
+type Backfill struct {
+	Ingester
+	Workers int
+	// 実行時間の上限（0の場合はLambdaのタイムアウトまで）
+	// 超えた場合は登録済みの日付までで中断する（API Gateway経由の実行は29秒で打ち切られるため）
+	Budget time.Duration
+}
+
+type BackfillResult struct {
+	Report
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	ResumedFrom time.Time `json:"resumedFrom"`
+	LastDate    time.Time `json:"lastDate"`
+	Days        int       `json:"days"`
+	Completed   bool      `json:"completed"`
+}
+
+type fetched struct {
+	day Day
+	err error
+}
+
+// 都道府県を指定した場合は都道府県の組み合わせごとに別ジョブとする
+func (b *Backfill) jobKey(from, to time.Time) string {
+	key := from.Format(DateLayout) + "-" + to.Format(DateLayout)
+	if len(b.Prefectures) == 0 {
+		return key
+	}
+	prefectures := append([]string(nil), b.Prefectures...)
+	sort.Strings(prefectures)
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(prefectures, ",")))
+	return fmt.Sprintf("%s-%08x", key, h.Sum32())
+}
+
+func (b *Backfill) Run(ctx context.Context, from, to time.Time) (BackfillResult, error) {
+	result := BackfillResult{From: from, To: to}
+	if to.Before(from) {
+		return result, fmt.Errorf("from %s is after to %s", from.Format(DateLayout), to.Format(DateLayout))
+	}
+
+	job := b.jobKey(from, to)
+	start := from
+	last, err := b.storage().Checkpoint(ctx, job)
+	if err != nil {
+		return result, err
+	}
+	if last != nil {
+		result.LastDate = *last
+		start = last.AddDate(0, 0, 1)
+	}
+	result.ResumedFrom = start
+	if start.After(to) {
+		result.Completed = true
+		return result, nil
+	}
+
+	var dates []time.Time
+	for d := start; !d.After(to); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stop <-chan time.Time
+	if b.Budget > 0 {
+		timer := time.NewTimer(b.Budget)
+		defer timer.Stop()
+		stop = timer.C
+	}
+
+	//ワーカープールで取得し、日付ごとのチャネルで結果を受け取る
+	results := make([]chan fetched, len(dates))
+	for i := range results {
+		results[i] = make(chan fetched, 1)
+	}
+	jobs := make(chan int)
+	workers := b.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				day, err := b.Source.Fetch(ctx, dates[i])
+				results[i] <- fetched{day: day, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range dates {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	//日付順に登録
+	for i, date := range dates {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < deadlineMargin {
+			return result, nil
+		}
+
+		var f fetched
+		select {
+		case f = <-results[i]:
+		case <-stop:
+			return result, nil
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+		//取得元にデータがない日は読み飛ばす（翌日の前日欠損として報告される）
+		if f.err != nil && !errors.Is(f.err, ErrNoData) {
+			return result, fmt.Errorf("%s: %w", date.Format(DateLayout), f.err)
+		}
+
+		report, err := b.Store(ctx, f.day)
+		result.Merge(report)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", date.Format(DateLayout), err)
+		}
+		if err = b.storage().SaveCheckpoint(ctx, job, date); err != nil {
+			return result, err
+		}
+		result.LastDate = date
+		result.Days++
+	}
+	result.Completed = true
+	return result, nil
+}
+
+// チェックポイントを削除して最初からやり直せるようにする
+func (b *Backfill) Reset(ctx context.Context, from, to time.Time) error {
+	return b.storage().DeleteCheckpoint(ctx, b.jobKey(from, to))
+}
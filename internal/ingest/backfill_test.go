@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	d := func(day int) time.Time { return date(2023, 1, day) }
+	var list []InfectionStatus
+	for day := 1; day <= 6; day++ {
+		list = append(list, cumulative(d(day), "東京都", 100+day*10))
+	}
+
+	t.Run("resume from checkpoint", func(t *testing.T) {
+		storage := newMemStorage(cumulative(d(2), "東京都", 120))
+		b := Backfill{Ingester: Ingester{Storage: storage, Source: newDaySource(Cumulative, list...)}}
+		storage.checkpoints[b.jobKey(d(1), d(4))] = d(2)
+
+		result, err := b.Run(context.Background(), d(1), d(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Completed || !result.ResumedFrom.Equal(d(3)) || !result.LastDate.Equal(d(4)) || result.Days != 2 || result.Inserted != 2 {
+			t.Errorf("Run() = %+v", result)
+		}
+		if want := []time.Time{d(3), d(4)}; !reflect.DeepEqual(storage.upserted, want) {
+			t.Errorf("upserted = %v, want %v", storage.upserted, want)
+		}
+		if last := storage.checkpoints[b.jobKey(d(1), d(4))]; !last.Equal(d(4)) {
+			t.Errorf("checkpoint = %v, want %v", last, d(4))
+		}
+
+		//完了済みのジョブは取得しない
+		result, err = b.Run(context.Background(), d(1), d(4))
+		if err != nil || !result.Completed || result.Days != 0 {
+			t.Errorf("Run() = %+v, %v", result, err)
+		}
+	})
+
+	t.Run("store in date order", func(t *testing.T) {
+		//前の日付ほど取得に時間がかかる
+		source := newDaySource(Cumulative, list[1:]...)
+		delete(source.days, d(4))
+		source.delay = func(date time.Time) time.Duration {
+			return time.Duration(7-date.Day()) * 5 * time.Millisecond
+		}
+		storage := newMemStorage(list[0])
+		b := Backfill{Ingester: Ingester{Storage: storage, Source: source, MaxLookback: 1}, Workers: 4}
+
+		result, err := b.Run(context.Background(), d(2), d(6))
+		if err != nil {
+			t.Fatal(err)
+		}
+		//データがない日は読み飛ばし、翌日の前日欠損として報告する
+		if want := []time.Time{d(2), d(3), d(5), d(6)}; !reflect.DeepEqual(storage.upserted, want) {
+			t.Errorf("upserted = %v, want %v", storage.upserted, want)
+		}
+		if want := []Missing{{Date: d(4), Prefecture: "東京都"}}; !result.Completed || result.Days != 5 || !reflect.DeepEqual(result.Unrecoverable, want) {
+			t.Errorf("Run() = %+v", result)
+		}
+		for day, want := range map[int]int{2: 10, 3: 10, 5: 0, 6: 10} {
+			if got, _ := storage.get(d(day), "東京都"); got.InfectionNumberDaily != want {
+				t.Errorf("%s daily = %d, want %d", d(day).Format(DateLayout), got.InfectionNumberDaily, want)
+			}
+		}
+	})
+
+	t.Run("stop at budget", func(t *testing.T) {
+		//初日以外は取得に時間がかかる
+		source := newDaySource(Cumulative, list...)
+		source.delay = func(date time.Time) time.Duration {
+			if date.After(d(1)) {
+				return time.Second
+			}
+			return 0
+		}
+		storage := newMemStorage()
+		b := Backfill{Ingester: Ingester{Storage: storage, Source: source}, Workers: 1, Budget: 100 * time.Millisecond}
+
+		result, err := b.Run(context.Background(), d(1), d(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Completed || result.Days != 1 || !result.LastDate.Equal(d(1)) {
+			t.Errorf("Run() = %+v", result)
+		}
+		if last := storage.checkpoints[b.jobKey(d(1), d(4))]; !last.Equal(d(1)) {
+			t.Errorf("checkpoint = %v, want %v", last, d(1))
+		}
+	})
+
+	t.Run("inverted range", func(t *testing.T) {
+		b := Backfill{Ingester: Ingester{Storage: newMemStorage(), Source: newDaySource(Cumulative)}}
+		if _, err := b.Run(context.Background(), d(4), d(1)); err == nil {
+			t.Error("Run() error = nil")
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package ingest
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+)
+
+// 厚生労働省のオープンデータ（新規陽性者数の推移）
+// https://www.mhlw.go.jp/stf/covid-19/open-data.html
+const MHLWDailyCSVURL = "https://covid19.mhlw.go.jp/public/opendata/newly_confirmed_cases_daily.csv"
+
+// 厚生労働省のCSVの初日（国内で最初の陽性者が確認された日）
+var EpidemicStart = time.Date(2020, 1, 16, 0, 0, 0, 0, time.UTC)
+
+// 日付,都道府県,新規陽性者数 のCSV
+// 都道府県は英語表記・日本語表記のどちらでもよく、全国計（ALL）の行は読み飛ばす
+type CSVSource struct {
+	// URLまたはファイルパス。未指定の場合は厚生労働省のCSV
+	Location   string
+	HTTPClient *http.Client
+
+	once  sync.Once
+	days  map[time.Time][]InfectionStatus
+	first time.Time
+	err   error
+}
+
+func (s *CSVSource) Name() string {
+	return "csv"
+}
+
+func (s *CSVSource) Fetch(ctx context.Context, date time.Time) (Day, error) {
+	s.once.Do(func() { s.err = s.load(ctx) })
+	day := Day{Date: date, Measure: Daily}
+	if s.err != nil {
+		return day, s.err
+	}
+
+	list, ok := s.days[date]
+	if !ok {
+		return day, ErrNoData
+	}
+	day.List = append([]InfectionStatus(nil), list...)
+
+	//流行初日から始まるCSVの初日は累積感染者数＝日次感染者数
+	//途中から始まるCSVの初日は日次のみとし、前日の累積感染者数は欠損として補完する
+	if date.Equal(s.first) && !s.first.After(EpidemicStart) {
+		day.Measure = Complete
+		for i := range day.List {
+			day.List[i].InfectionNumberCumulatively = day.List[i].InfectionNumberDaily
+		}
+	}
+	return day, nil
+}
+
+func (s *CSVSource) open(ctx context.Context) (io.ReadCloser, error) {
+	location := s.Location
+	if location == "" {
+		location = MHLWDailyCSVURL
+	}
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.Open(location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: status %d", location, res.StatusCode)
+	}
+	return res.Body, nil
+}
+
+func (s *CSVSource) load(ctx context.Context) error {
+	rc, err := s.open(ctx)
+	if err != nil {
+		return problem.Upstream(err)
+	}
+	defer rc.Close()
+
+	r := csv.NewReader(rc)
+	r.FieldsPerRecord = 3
+	s.days = make(map[time.Time][]InfectionStatus)
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		//ヘッダー
+		if line == 1 {
+			continue
+		}
+
+		date, err := parseCSVDate(strings.TrimPrefix(record[0], "\ufeff"))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		name, ok := prefecture.Normalize(strings.TrimSpace(record[1]))
+		if !ok {
+			continue
+		}
+		daily, err := strconv.Atoi(strings.TrimSpace(record[2]))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		s.days[date] = append(s.days[date], InfectionStatus{
+			Date:                 date,
+			Prefecture:           name,
+			InfectionNumberDaily: daily,
+		})
+		if s.first.IsZero() || date.Before(s.first) {
+			s.first = date
+		}
+	}
+	return nil
+}
+
+func parseCSVDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006/1/2", "2006-01-02", DateLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", s)
+}
@@ -0,0 +1,219 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/tsuvic/ca-geo-corona/internal/clock"
+	"github.com/tsuvic/ca-geo-corona/internal/opendata"
+)
+
+const DefaultMaxLookback = 7
+
+// 前日のデータが欠損している場合は、欠損日を先に取得・登録してから日次感染者数を算出する
+// MaxLookback日遡っても埋められない欠損はReportのUnrecoverableに記録し、日次感染者数は0とする
+// （日次感染者数のみの取得元の場合は累積感染者数が不明のため登録しない）
+// Prefecturesを指定した場合はその都道府県のみ登録し、それ以外の都道府県の行には触れない
+type Ingester struct {
+	DB          *sql.DB
+	Storage     Storage
+	Source      Source
+	MaxLookback int
+	Prefectures []string
+	Clock       clock.Clock
+}
+
+type Missing struct {
+	Date       time.Time `json:"date"`
+	Prefecture string    `json:"prefecture"`
+}
+
+type Report struct {
+	Result
+	Repaired      []time.Time `json:"repaired,omitempty"`
+	Unrecoverable []Missing   `json:"unrecoverable,omitempty"`
+}
+
+func (r *Report) Merge(other Report) {
+	r.Result.Add(other.Result)
+	r.Repaired = append(r.Repaired, other.Repaired...)
+	for _, m := range other.Unrecoverable {
+		r.addUnrecoverable(m)
+	}
+}
+
+func (r *Report) addUnrecoverable(m Missing) {
+	for _, val := range r.Unrecoverable {
+		if val.Date.Equal(m.Date) && val.Prefecture == m.Prefecture {
+			return
+		}
+	}
+	r.Unrecoverable = append(r.Unrecoverable, m)
+	sort.Slice(r.Unrecoverable, func(i, j int) bool {
+		if !r.Unrecoverable[i].Date.Equal(r.Unrecoverable[j].Date) {
+			return r.Unrecoverable[i].Date.Before(r.Unrecoverable[j].Date)
+		}
+		return r.Unrecoverable[i].Prefecture < r.Unrecoverable[j].Prefecture
+	})
+}
+
+func (in *Ingester) now() time.Time {
+	if in.Clock == nil {
+		return clock.System{}.Now()
+	}
+	return in.Clock.Now()
+}
+
+func (in *Ingester) storage() Storage {
+	if in.Storage == nil {
+		return SQLStorage{DB: in.DB}
+	}
+	return in.Storage
+}
+
+func (in *Ingester) maxLookback() int {
+	if in.MaxLookback <= 0 {
+		return DefaultMaxLookback
+	}
+	return in.MaxLookback
+}
+
+// 指定日のデータを取得して登録する
+func (in *Ingester) IngestDay(ctx context.Context, date time.Time) (Report, error) {
+	var report Report
+	day, err := in.Source.Fetch(ctx, date)
+	if err != nil {
+		return report, err
+	}
+	err = in.store(ctx, in.filter(day), 0, &report)
+	return report, err
+}
+
+// 取得済みの1日分を登録する
+func (in *Ingester) Store(ctx context.Context, day Day) (Report, error) {
+	var report Report
+	err := in.store(ctx, in.filter(day), 0, &report)
+	return report, err
+}
+
+func (in *Ingester) filter(day Day) Day {
+	if len(in.Prefectures) == 0 {
+		return day
+	}
+	var filtered []InfectionStatus
+	for _, val := range day.List {
+		for _, p := range in.Prefectures {
+			if val.Prefecture == p {
+				filtered = append(filtered, val)
+				break
+			}
+		}
+	}
+	day.List = filtered
+	return day
+}
+
+func (in *Ingester) store(ctx context.Context, day Day, depth int, report *Report) error {
+	if len(day.List) == 0 {
+		return nil
+	}
+	dayBefore := day.Date.AddDate(0, 0, -1)
+
+	before, err := in.storage().Cumulatives(ctx, dayBefore)
+	if err != nil {
+		return err
+	}
+
+	//前日欠損の補完
+	var missing []string
+	if day.Measure != Complete {
+		for _, val := range day.List {
+			if _, ok := before[val.Prefecture]; !ok {
+				missing = append(missing, val.Prefecture)
+			}
+		}
+	}
+	if len(missing) > 0 && depth < in.maxLookback() {
+		if err := in.repair(ctx, dayBefore, missing, depth+1, report); err != nil {
+			return err
+		}
+		if before, err = in.storage().Cumulatives(ctx, dayBefore); err != nil {
+			return err
+		}
+	}
+
+	//日次・累積 感染者数
+	infectionStatusList := make([]InfectionStatus, 0, len(day.List))
+	for _, val := range day.List {
+		cumulative, ok := before[val.Prefecture]
+		switch {
+		case day.Measure == Complete:
+		case !ok:
+			report.addUnrecoverable(Missing{Date: dayBefore, Prefecture: val.Prefecture})
+			//日次のみの取得元では累積感染者数が不明のため登録しない
+			if day.Measure == Daily {
+				continue
+			}
+			val.InfectionNumberDaily = 0
+		case day.Measure == Cumulative:
+			val.InfectionNumberDaily = val.InfectionNumberCumulatively - cumulative
+		case day.Measure == Daily:
+			val.InfectionNumberCumulatively = cumulative + val.InfectionNumberDaily
+		}
+		infectionStatusList = append(infectionStatusList, val)
+	}
+	if len(infectionStatusList) == 0 {
+		return nil
+	}
+
+	result, err := in.storage().Upsert(ctx, infectionStatusList, in.now())
+	report.Add(result)
+	return err
+}
+
+// 欠損日のうち指定都道府県のデータのみを登録する
+func (in *Ingester) repair(ctx context.Context, date time.Time, prefectures []string, depth int, report *Report) error {
+	day, err := in.Source.Fetch(ctx, date)
+	if errors.Is(err, ErrNoData) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	target := make(map[string]bool, len(prefectures))
+	for _, p := range prefectures {
+		target[p] = true
+	}
+	var repairList []InfectionStatus
+	for _, val := range day.List {
+		if target[val.Prefecture] {
+			repairList = append(repairList, val)
+		}
+	}
+	if len(repairList) == 0 {
+		return nil
+	}
+	day.List = repairList
+
+	if err := in.store(ctx, day, depth, report); err != nil {
+		return err
+	}
+	report.Repaired = append(report.Repaired, date)
+	return nil
+}
+
+// 取得元にデータが存在しない（補完不能）エラー
+func noData(err error) bool {
+	//それ以外のAPIのエラーは外部APIの失敗として返す
+	var apiErr *opendata.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.NoData()
+	}
+	var statusErr *opendata.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests
+}
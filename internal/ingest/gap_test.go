@@ -0,0 +1,217 @@
+package ingest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+)
+
+// メモリ上の登録先
+type memStorage struct {
+	days        map[time.Time]map[string]InfectionStatus
+	checkpoints map[string]time.Time
+	// Upsertした日付（呼び出し順）
+	upserted []time.Time
+}
+
+func newMemStorage(list ...InfectionStatus) *memStorage {
+	m := &memStorage{days: make(map[time.Time]map[string]InfectionStatus), checkpoints: make(map[string]time.Time)}
+	for _, val := range list {
+		m.day(val.Date)[val.Prefecture] = val
+	}
+	return m
+}
+
+func (m *memStorage) day(date time.Time) map[string]InfectionStatus {
+	if m.days[date] == nil {
+		m.days[date] = make(map[string]InfectionStatus)
+	}
+	return m.days[date]
+}
+
+func (m *memStorage) get(date time.Time, name string) (InfectionStatus, bool) {
+	val, ok := m.days[date][name]
+	return val, ok
+}
+
+func (m *memStorage) Cumulatives(ctx context.Context, date time.Time) (map[string]int, error) {
+	c := make(map[string]int)
+	for name, val := range m.days[date] {
+		c[name] = val.InfectionNumberCumulatively
+	}
+	return c, nil
+}
+
+func (m *memStorage) Upsert(ctx context.Context, infectionStatusList []InfectionStatus, recordedAt time.Time) (Result, error) {
+	if len(infectionStatusList) == 0 {
+		return Result{}, nil
+	}
+	date := infectionStatusList[0].Date
+	m.upserted = append(m.upserted, date)
+	result, _ := apply(m.day(date), infectionStatusList)
+	return result, nil
+}
+
+func (m *memStorage) Checkpoint(ctx context.Context, job string) (*time.Time, error) {
+	last, ok := m.checkpoints[job]
+	if !ok {
+		return nil, nil
+	}
+	return &last, nil
+}
+
+func (m *memStorage) SaveCheckpoint(ctx context.Context, job string, date time.Time) error {
+	m.checkpoints[job] = date
+	return nil
+}
+
+func (m *memStorage) DeleteCheckpoint(ctx context.Context, job string) error {
+	delete(m.checkpoints, job)
+	return nil
+}
+
+// 日付ごとのデータを返す取得元（delayを指定した場合は取得を遅らせる）
+type daySource struct {
+	measure Measure
+	days    map[time.Time][]InfectionStatus
+	delay   func(date time.Time) time.Duration
+}
+
+func newDaySource(measure Measure, list ...InfectionStatus) daySource {
+	s := daySource{measure: measure, days: make(map[time.Time][]InfectionStatus)}
+	for _, val := range list {
+		s.days[val.Date] = append(s.days[val.Date], val)
+	}
+	return s
+}
+
+func (s daySource) Name() string { return "days" }
+
+func (s daySource) Fetch(ctx context.Context, date time.Time) (Day, error) {
+	if s.delay != nil {
+		time.Sleep(s.delay(date))
+	}
+	day := Day{Date: date, Measure: s.measure}
+	list, ok := s.days[date]
+	if !ok {
+		return day, ErrNoData
+	}
+	day.List = append([]InfectionStatus(nil), list...)
+	return day, nil
+}
+
+func cumulative(d time.Time, name string, n int) InfectionStatus {
+	return InfectionStatus{Date: d, Prefecture: name, InfectionNumberCumulatively: n}
+}
+
+func TestIngester(t *testing.T) {
+	d1, d2, d3 := date(2023, 1, 1), date(2023, 1, 2), date(2023, 1, 3)
+
+	type want struct {
+		date       time.Time
+		prefecture string
+		daily      int
+		cumulative int
+	}
+	tests := []struct {
+		name        string
+		storage     *memStorage
+		source      daySource
+		maxLookback int
+		prefectures []string
+		date        time.Time
+		want        []want
+		wantMissing []want
+		wantReport  Report
+	}{
+		{
+			name:       "daily from previous cumulative",
+			storage:    newMemStorage(cumulative(d1, "東京都", 100)),
+			source:     newDaySource(Cumulative, cumulative(d2, "東京都", 110)),
+			date:       d2,
+			want:       []want{{d2, "東京都", 10, 110}},
+			wantReport: Report{Result: Result{Inserted: 1}},
+		},
+		{
+			name:    "repair missing previous day",
+			storage: newMemStorage(cumulative(d1, "東京都", 100)),
+			source:  newDaySource(Cumulative, cumulative(d2, "東京都", 110), cumulative(d3, "東京都", 125)),
+			date:    d3,
+			want:    []want{{d2, "東京都", 10, 110}, {d3, "東京都", 15, 125}},
+			wantReport: Report{
+				Result:   Result{Inserted: 2},
+				Repaired: []time.Time{d2},
+			},
+		},
+		{
+			//1日だけ遡り、補完できない前日は日次感染者数を0とする
+			name:        "repair depth limit",
+			storage:     newMemStorage(),
+			source:      newDaySource(Cumulative, cumulative(d1, "東京都", 100), cumulative(d2, "東京都", 110), cumulative(d3, "東京都", 125)),
+			maxLookback: 1,
+			date:        d3,
+			want:        []want{{d2, "東京都", 0, 110}, {d3, "東京都", 15, 125}},
+			wantMissing: []want{{date: d1, prefecture: "東京都"}},
+			wantReport: Report{
+				Result:        Result{Inserted: 2},
+				Repaired:      []time.Time{d2},
+				Unrecoverable: []Missing{{Date: d1, Prefecture: "東京都"}},
+			},
+		},
+		{
+			//日次のみの取得元では累積感染者数が不明のため登録しない
+			name:        "unrecoverable daily source",
+			storage:     newMemStorage(),
+			source:      newDaySource(Daily, InfectionStatus{Date: d2, Prefecture: "東京都", InfectionNumberDaily: 10}),
+			date:        d2,
+			wantMissing: []want{{date: d2, prefecture: "東京都"}},
+			wantReport:  Report{Unrecoverable: []Missing{{Date: d1, Prefecture: "東京都"}}},
+		},
+		{
+			name: "prefecture filter leaves other rows",
+			storage: newMemStorage(
+				cumulative(d1, "東京都", 100), cumulative(d1, "大阪府", 50),
+				InfectionStatus{Date: d2, Prefecture: "大阪府", InfectionNumberDaily: 3, InfectionNumberCumulatively: 53},
+			),
+			source:      newDaySource(Cumulative, cumulative(d2, "東京都", 110), cumulative(d2, "大阪府", 60)),
+			prefectures: []string{"東京都"},
+			date:        d2,
+			want:        []want{{d2, "東京都", 10, 110}, {d2, "大阪府", 3, 53}, {d2, prefecture.National, 13, 163}},
+			wantReport:  Report{Result: Result{Inserted: 1}},
+		},
+		{
+			name:       "unchanged",
+			storage:    newMemStorage(cumulative(d1, "東京都", 100), InfectionStatus{Date: d2, Prefecture: "東京都", InfectionNumberDaily: 10, InfectionNumberCumulatively: 110}),
+			source:     newDaySource(Cumulative, cumulative(d2, "東京都", 110)),
+			date:       d2,
+			want:       []want{{d2, "東京都", 10, 110}},
+			wantReport: Report{Result: Result{Unchanged: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := Ingester{Storage: tt.storage, Source: tt.source, MaxLookback: tt.maxLookback, Prefectures: tt.prefectures}
+			report, err := in.IngestDay(context.Background(), tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(report, tt.wantReport) {
+				t.Errorf("IngestDay() = %+v, want %+v", report, tt.wantReport)
+			}
+			for _, w := range tt.want {
+				got, ok := tt.storage.get(w.date, w.prefecture)
+				if !ok || got.InfectionNumberDaily != w.daily || got.InfectionNumberCumulatively != w.cumulative {
+					t.Errorf("%s %s = %+v, %v, want daily %d, cumulative %d", w.date.Format(DateLayout), w.prefecture, got, ok, w.daily, w.cumulative)
+				}
+			}
+			for _, w := range tt.wantMissing {
+				if got, ok := tt.storage.get(w.date, w.prefecture); ok {
+					t.Errorf("%s %s = %+v, want not stored", w.date.Format(DateLayout), w.prefecture, got)
+				}
+			}
+		})
+	}
+}
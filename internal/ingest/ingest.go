@@ -0,0 +1,211 @@
+// 感染者数データの取得・登録処理
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tsuvic/ca-geo-corona/internal/dbutil"
+	"github.com/tsuvic/ca-geo-corona/internal/opendata"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+)
+
+const DateLayout = "20060102"
+
+type InfectionStatus struct {
+	Date                        time.Time `json:"date"`
+	Prefecture                  string    `json:"prefecture"`
+	InfectionNumberDaily        int       `json:"infectionNumberDaily"`
+	InfectionNumberCumulatively int       `json:"infectionNumberCumulatively"`
+	// 全国の行のみ、集計に含まれる都道府県数
+	PrefectureCount *int `json:"prefectureCount,omitempty"`
+}
+
+func (s InfectionStatus) equal(other InfectionStatus) bool {
+	if s.InfectionNumberDaily != other.InfectionNumberDaily || s.InfectionNumberCumulatively != other.InfectionNumberCumulatively {
+		return false
+	}
+	if s.PrefectureCount == nil || other.PrefectureCount == nil {
+		return s.PrefectureCount == nil && other.PrefectureCount == nil
+	}
+	return *s.PrefectureCount == *other.PrefectureCount
+}
+
+// 都道府県別の値を合計した全国の行
+// 欠けている都道府県は補わず、PrefectureCountで集計に含まれる都道府県数を示す
+func NationalTotal(date time.Time, infectionStatusList []InfectionStatus) InfectionStatus {
+	national := InfectionStatus{Date: date, Prefecture: prefecture.National}
+	count := 0
+	for _, val := range infectionStatusList {
+		if !prefecture.Valid(val.Prefecture) {
+			continue
+		}
+		national.InfectionNumberDaily += val.InfectionNumberDaily
+		national.InfectionNumberCumulatively += val.InfectionNumberCumulatively
+		count++
+	}
+	national.PrefectureCount = &count
+	return national
+}
+
+type Fetcher interface {
+	Covid19JapanAll(ctx context.Context, date time.Time) (*opendata.Covid19JapanAllResponse, error)
+}
+
+// APIレスポンスを累積感染者数のみ設定したInfectionStatusに変換する
+func Parse(res *opendata.Covid19JapanAllResponse) ([]InfectionStatus, error) {
+	infectionStatusList := make([]InfectionStatus, 0, len(res.ItemList))
+	for _, item := range res.ItemList {
+		var infectionStatus InfectionStatus
+
+		//都道府県
+		infectionStatus.Prefecture = item.NameJp
+
+		//日付
+		t, err := time.Parse("2006-01-02", item.Date)
+		if err != nil {
+			return nil, err
+		}
+		infectionStatus.Date = t
+
+		//累積 感染者数
+		cumulative, err := strconv.Atoi(item.NPatients)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", item.Date, item.NameJp, err)
+		}
+		infectionStatus.InfectionNumberCumulatively = cumulative
+
+		infectionStatusList = append(infectionStatusList, infectionStatus)
+	}
+	return infectionStatusList, nil
+}
+
+// 登録結果
+type Result struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	// 異常値として検出した行数
+	Flagged int `json:"flagged"`
+}
+
+func (r *Result) Add(other Result) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Unchanged += other.Unchanged
+	r.Flagged += other.Flagged
+}
+
+// (date, prefecture)をキーに1日分をトランザクション内で登録・更新し、全国の行を再集計する
+// 登録済みの行と比較して登録・更新・変更なしを判定し、変更のある行のみ複数行INSERTで書き込む
+// 変更のある行は取得時刻recordedAtとともに infection_status_version に履歴として追記する
+// 登録した都道府県と全国の行は直近の履歴と比較し、異常値を infection_status_anomaly に記録する
+func Upsert(ctx context.Context, db *sql.DB, infectionStatusList []InfectionStatus, recordedAt time.Time) (Result, error) {
+	var result Result
+	if len(infectionStatusList) == 0 {
+		return result, nil
+	}
+
+	err := dbutil.WithTx(ctx, db, func(tx *sql.Tx) error {
+		current, err := currentDay(ctx, tx, infectionStatusList[0].Date)
+		if err != nil {
+			return err
+		}
+
+		var changed []InfectionStatus
+		result, changed = apply(current, infectionStatusList)
+		national := current[prefecture.National]
+		rows := make([][]interface{}, len(changed))
+		for i, val := range changed {
+			rows[i] = []interface{}{val.Date, val.Prefecture, val.InfectionNumberDaily, val.InfectionNumberCumulatively, val.PrefectureCount}
+		}
+
+		//登録した都道府県と全国の行の異常値の検出
+		targets := append([]InfectionStatus{national}, infectionStatusList...)
+		flagged, err := flagAnomalies(ctx, tx, national.Date, targets, recordedAt)
+		if err != nil {
+			return err
+		}
+		result.Flagged = flagged
+
+		_, err = dbutil.BulkInsert(ctx, tx,
+			"INSERT INTO infection_status (date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count)",
+			"ON DUPLICATE KEY UPDATE infection_number_daily = VALUES(infection_number_daily), infection_number_cumulatively = VALUES(infection_number_cumulatively), prefecture_count = VALUES(prefecture_count)",
+			rows, dbutil.DefaultChunkSize)
+		if err != nil {
+			return err
+		}
+
+		//登録・更新した値は取得時刻とともに履歴に残す
+		for i := range rows {
+			rows[i] = append(rows[i], recordedAt.UTC())
+		}
+		_, err = dbutil.BulkInsert(ctx, tx,
+			"INSERT INTO infection_status_version (date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count, recorded_at)",
+			"", rows, dbutil.DefaultChunkSize)
+		return err
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// 登録済みの1日分currentに登録する行を反映し、登録・更新・変更なしの件数と、変更のある行（全国の行を含む）を返す
+// 全国の行は反映後の都道府県別の行から再集計する
+func apply(current map[string]InfectionStatus, infectionStatusList []InfectionStatus) (Result, []InfectionStatus) {
+	var result Result
+	var changed []InfectionStatus
+	for _, val := range infectionStatusList {
+		cur, ok := current[val.Prefecture]
+		switch {
+		case !ok:
+			result.Inserted++
+		case !cur.equal(val):
+			result.Updated++
+		default:
+			result.Unchanged++
+			continue
+		}
+		current[val.Prefecture] = val
+		changed = append(changed, val)
+	}
+
+	day := make([]InfectionStatus, 0, len(current))
+	for _, val := range current {
+		day = append(day, val)
+	}
+	national := NationalTotal(infectionStatusList[0].Date, day)
+	if cur, ok := current[prefecture.National]; !ok || !cur.equal(national) {
+		current[prefecture.National] = national
+		changed = append(changed, national)
+	}
+	return result, changed
+}
+
+// 登録済みの1日分を行ロックして取得する
+func currentDay(ctx context.Context, tx *sql.Tx, date time.Time) (map[string]InfectionStatus, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count FROM infection_status WHERE date = ? FOR UPDATE", date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[string]InfectionStatus)
+	for rows.Next() {
+		infectionStatus := InfectionStatus{Date: date}
+		var prefectureCount sql.NullInt64
+		if err := rows.Scan(&infectionStatus.Prefecture, &infectionStatus.InfectionNumberDaily, &infectionStatus.InfectionNumberCumulatively, &prefectureCount); err != nil {
+			return nil, err
+		}
+		if prefectureCount.Valid {
+			count := int(prefectureCount.Int64)
+			infectionStatus.PrefectureCount = &count
+		}
+		m[infectionStatus.Prefecture] = infectionStatus
+	}
+	return m, rows.Err()
+}
@@ -0,0 +1,128 @@
+package ingest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/tsuvic/ca-geo-corona/internal/anomaly"
+	"github.com/tsuvic/ca-geo-corona/internal/prefecture"
+)
+
+func TestNationalTotal(t *testing.T) {
+	d := date(2023, 1, 2)
+	tests := []struct {
+		name      string
+		list      []InfectionStatus
+		wantDaily int
+		wantCum   int
+		wantCount int
+	}{
+		{
+			name:      "empty",
+			wantCount: 0,
+		},
+		{
+			name: "sum prefectures",
+			list: []InfectionStatus{
+				{Date: d, Prefecture: "東京都", InfectionNumberDaily: 10, InfectionNumberCumulatively: 100},
+				{Date: d, Prefecture: "大阪府", InfectionNumberDaily: 5, InfectionNumberCumulatively: 50},
+			},
+			wantDaily: 15,
+			wantCum:   150,
+			wantCount: 2,
+		},
+		{
+			name: "ignore national and unknown rows",
+			list: []InfectionStatus{
+				{Date: d, Prefecture: "東京都", InfectionNumberDaily: 10, InfectionNumberCumulatively: 100},
+				{Date: d, Prefecture: prefecture.National, InfectionNumberDaily: 999, InfectionNumberCumulatively: 999},
+				{Date: d, Prefecture: "ALL", InfectionNumberDaily: 999, InfectionNumberCumulatively: 999},
+			},
+			wantDaily: 10,
+			wantCum:   100,
+			wantCount: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NationalTotal(d, tt.list)
+			if got.Prefecture != prefecture.National || !got.Date.Equal(d) {
+				t.Errorf("NationalTotal() = %#v", got)
+			}
+			if got.InfectionNumberDaily != tt.wantDaily || got.InfectionNumberCumulatively != tt.wantCum {
+				t.Errorf("NationalTotal() daily = %d, cumulative = %d, want %d, %d", got.InfectionNumberDaily, got.InfectionNumberCumulatively, tt.wantDaily, tt.wantCum)
+			}
+			if got.PrefectureCount == nil || *got.PrefectureCount != tt.wantCount {
+				t.Errorf("NationalTotal() PrefectureCount = %v, want %d", got.PrefectureCount, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	d := date(2023, 2, 1)
+	var history []InfectionStatus
+	for i := 1; i <= 28; i++ {
+		history = append(history,
+			InfectionStatus{Date: d.AddDate(0, 0, -i), Prefecture: "東京都", InfectionNumberDaily: 1000 + i%7*10},
+			InfectionStatus{Date: d.AddDate(0, 0, -i), Prefecture: "大阪府", InfectionNumberDaily: 500 + i%7*10},
+		)
+	}
+	//当日・期間外の行は使わない
+	history = append(history,
+		InfectionStatus{Date: d, Prefecture: "東京都", InfectionNumberDaily: 99999},
+		InfectionStatus{Date: d.AddDate(0, 0, -29), Prefecture: "東京都", InfectionNumberDaily: 99999},
+	)
+
+	got := Detect(d, []InfectionStatus{
+		{Date: d, Prefecture: "東京都", InfectionNumberDaily: 8000},
+		{Date: d, Prefecture: "大阪府", InfectionNumberDaily: 520},
+		{Date: d, Prefecture: "北海道", InfectionNumberDaily: -3},
+	}, history)
+	if len(got) != 2 {
+		t.Fatalf("Detect() = %+v", got)
+	}
+	if got[0].Prefecture != "東京都" || got[0].Reason != anomaly.Outlier || got[0].Expected != 1030 || got[0].InfectionNumberDaily != 8000 {
+		t.Errorf("Detect()[0] = %+v", got[0])
+	}
+	if got[1].Prefecture != "北海道" || got[1].Reason != anomaly.Negative || !math.IsNaN(got[1].Expected) {
+		t.Errorf("Detect()[1] = %+v", got[1])
+	}
+}
+
+func TestApply(t *testing.T) {
+	d := date(2023, 1, 2)
+	count := 2
+	current := map[string]InfectionStatus{
+		"東京都":               {Date: d, Prefecture: "東京都", InfectionNumberDaily: 10, InfectionNumberCumulatively: 100},
+		"大阪府":               {Date: d, Prefecture: "大阪府", InfectionNumberDaily: 5, InfectionNumberCumulatively: 50},
+		prefecture.National: {Date: d, Prefecture: prefecture.National, InfectionNumberDaily: 15, InfectionNumberCumulatively: 150, PrefectureCount: &count},
+	}
+
+	//変更なしの場合は全国の行も書き込まない
+	result, changed := apply(current, []InfectionStatus{current["東京都"]})
+	if result != (Result{Unchanged: 1}) || len(changed) != 0 {
+		t.Errorf("apply() = %+v, %+v", result, changed)
+	}
+
+	result, changed = apply(current, []InfectionStatus{
+		{Date: d, Prefecture: "東京都", InfectionNumberDaily: 10, InfectionNumberCumulatively: 100},
+		{Date: d, Prefecture: "大阪府", InfectionNumberDaily: 6, InfectionNumberCumulatively: 51},
+		{Date: d, Prefecture: "北海道", InfectionNumberDaily: 1, InfectionNumberCumulatively: 1},
+	})
+	if result != (Result{Inserted: 1, Updated: 1, Unchanged: 1}) {
+		t.Errorf("apply() = %+v", result)
+	}
+	var names []string
+	for _, val := range changed {
+		names = append(names, val.Prefecture)
+	}
+	if want := []string{"大阪府", "北海道", prefecture.National}; !reflect.DeepEqual(names, want) {
+		t.Errorf("changed = %v, want %v", names, want)
+	}
+	national := current[prefecture.National]
+	if national.InfectionNumberDaily != 17 || national.InfectionNumberCumulatively != 152 || *national.PrefectureCount != 3 {
+		t.Errorf("national = %+v", national)
+	}
+}
@@ -0,0 +1,151 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tsuvic/ca-geo-corona/internal/archive"
+	"github.com/tsuvic/ca-geo-corona/internal/opendata"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+)
+
+// 取得元に指定日のデータが存在しない
+var ErrNoData = errors.New("no data for the date")
+
+// 環境変数 ARCHIVE を設定せずに保存済みのレスポンスからの登録を指定した
+var ErrReplayWithoutArchive = errors.New("replay requires ARCHIVE")
+
+// 取得元が提供する値
+type Measure int
+
+const (
+	// 累積感染者数のみ（日次感染者数は前日の累積から算出する）
+	Cumulative Measure = iota
+	// 日次感染者数のみ（累積感染者数は前日の累積に加算する）
+	Daily
+	// 両方
+	Complete
+)
+
+// 1日分の都道府県別データ
+type Day struct {
+	Date    time.Time
+	Measure Measure
+	List    []InfectionStatus
+}
+
+// 感染者数データの取得元
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context, date time.Time) (Day, error)
+}
+
+// opendata.corona.go.jp の Covid19JapanAll
+type APISource struct {
+	Fetcher Fetcher
+}
+
+func (s *APISource) Name() string {
+	return "api"
+}
+
+func (s *APISource) Fetch(ctx context.Context, date time.Time) (Day, error) {
+	day := Day{Date: date, Measure: Cumulative}
+	res, err := s.Fetcher.Covid19JapanAll(ctx, date)
+	if noData(err) {
+		return day, fmt.Errorf("%w: %v", ErrNoData, err)
+	}
+	//通信エラーを含め、取得の失敗は外部APIの失敗（502）として返す
+	if err != nil {
+		return day, problem.Upstream(err)
+	}
+	infectionStatusList, err := Parse(res)
+	if err != nil {
+		return day, err
+	}
+
+	//指定日以外のデータは古いデータとして扱わない
+	for _, val := range infectionStatusList {
+		if val.Date.Equal(date) {
+			day.List = append(day.List, val)
+		}
+	}
+	if len(day.List) == 0 {
+		return day, ErrNoData
+	}
+	return day, nil
+}
+
+// 先頭の取得元から順に取得し、データが存在しない・取得できない場合は次の取得元を使う
+type Fallback []Source
+
+func (f Fallback) Name() string {
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (f Fallback) Fetch(ctx context.Context, date time.Time) (Day, error) {
+	var lastErr error = ErrNoData
+	for _, s := range f {
+		day, err := s.Fetch(ctx, date)
+		if err == nil {
+			return day, nil
+		}
+		if !errors.Is(err, ErrNoData) {
+			fmt.Printf("source %s: %v\n", s.Name(), err)
+			lastErr = err
+		}
+	}
+	return Day{Date: date}, lastErr
+}
+
+// 環境変数 SOURCE（api, csv またはカンマ区切りで優先順に複数）から取得元を作成する
+// csvの取得先は環境変数 CSV_SOURCE（URLまたはファイルパス）
+func SourceFromEnv(fetcher Fetcher, httpClient *http.Client) (Source, error) {
+	spec := os.Getenv("SOURCE")
+	if spec == "" {
+		spec = "api"
+	}
+
+	var sources Fallback
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "api":
+			sources = append(sources, &APISource{Fetcher: fetcher})
+		case "csv":
+			sources = append(sources, &CSVSource{Location: os.Getenv("CSV_SOURCE"), HTTPClient: httpClient})
+		default:
+			return nil, fmt.Errorf("unknown source: %s", name)
+		}
+	}
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
+	return sources, nil
+}
+
+// 環境変数 SOURCE で取得元を選択する
+// 環境変数 ARCHIVE を設定した場合は取得したレスポンスを保存し、replayの場合は保存済みのレスポンスから登録する
+func NewSource(ctx context.Context, replay bool) (Source, error) {
+	opts := opendata.OptionsFromEnv()
+	store, err := archive.FromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		opts.Transport = archive.Transport(store, replay)
+	} else if replay {
+		return nil, ErrReplayWithoutArchive
+	}
+	//CSVの取得にもAPIと同じタイムアウト（OPENDATA_TIMEOUT）を使う
+	opts.HTTPClient = opts.NewHTTPClient()
+	return SourceFromEnv(opendata.NewClient(opts), opts.HTTPClient)
+}
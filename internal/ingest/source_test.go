@@ -0,0 +1,207 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tsuvic/ca-geo-corona/internal/opendata"
+)
+
+type fileFetcher map[string]string
+
+func (f fileFetcher) Covid19JapanAll(ctx context.Context, date time.Time) (*opendata.Covid19JapanAllResponse, error) {
+	name, ok := f[date.Format(DateLayout)]
+	if !ok {
+		return nil, &opendata.APIError{ErrorCode: "E100", ErrorMessage: "no data"}
+	}
+	if name == "" {
+		return nil, &opendata.APIError{ErrorCode: "E001", ErrorMessage: "invalid date"}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var res opendata.Covid19JapanAllResponse
+	err = json.Unmarshal(data, &res)
+	return &res, err
+}
+
+type errSource struct{ err error }
+
+func (s errSource) Name() string { return "err" }
+func (s errSource) Fetch(ctx context.Context, date time.Time) (Day, error) {
+	return Day{Date: date}, s.err
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAPISource(t *testing.T) {
+	s := &APISource{Fetcher: fileFetcher{"20230102": "testdata/covid19japanall_20230102.json", "20230104": ""}}
+
+	t.Run("Cumulative only for the date", func(t *testing.T) {
+		got, err := s.Fetch(context.Background(), date(2023, 1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Day{
+			Date:    date(2023, 1, 2),
+			Measure: Cumulative,
+			List: []InfectionStatus{
+				{Date: date(2023, 1, 2), Prefecture: "北海道", InfectionNumberCumulatively: 105},
+				{Date: date(2023, 1, 2), Prefecture: "東京都", InfectionNumberCumulatively: 205},
+			},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Fetch() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("No data", func(t *testing.T) {
+		_, err := s.Fetch(context.Background(), date(2023, 1, 3))
+		if !errors.Is(err, ErrNoData) {
+			t.Errorf("Fetch() error = %v, want ErrNoData", err)
+		}
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		_, err := s.Fetch(context.Background(), date(2023, 1, 4))
+		var apiErr *opendata.APIError
+		if errors.Is(err, ErrNoData) || !errors.As(err, &apiErr) {
+			t.Errorf("Fetch() error = %v, want APIError", err)
+		}
+	})
+}
+
+func TestCSVSource(t *testing.T) {
+	s := &CSVSource{Location: "testdata/newly_confirmed_cases_daily.csv"}
+
+	tests := []struct {
+		name    string
+		date    time.Time
+		want    Day
+		wantErr error
+	}{
+		{
+			//途中から始まるCSVの初日は累積感染者数が不明
+			name: "first day of partial file is daily only",
+			date: date(2023, 1, 1),
+			want: Day{
+				Date:    date(2023, 1, 1),
+				Measure: Daily,
+				List: []InfectionStatus{
+					{Date: date(2023, 1, 1), Prefecture: "北海道", InfectionNumberDaily: 1},
+					{Date: date(2023, 1, 1), Prefecture: "東京都", InfectionNumberDaily: 2},
+				},
+			},
+		},
+		{
+			name: "daily only",
+			date: date(2023, 1, 2),
+			want: Day{
+				Date:    date(2023, 1, 2),
+				Measure: Daily,
+				List: []InfectionStatus{
+					{Date: date(2023, 1, 2), Prefecture: "北海道", InfectionNumberDaily: 4},
+					{Date: date(2023, 1, 2), Prefecture: "東京都", InfectionNumberDaily: 5},
+				},
+			},
+		},
+		{
+			name:    "no data",
+			date:    date(2023, 1, 3),
+			want:    Day{Date: date(2023, 1, 3), Measure: Daily},
+			wantErr: ErrNoData,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Fetch(context.Background(), tt.date)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Fetch() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fetch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVSourceEpidemicStart(t *testing.T) {
+	s := &CSVSource{Location: "testdata/newly_confirmed_cases_daily_start.csv"}
+	got, err := s.Fetch(context.Background(), EpidemicStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Day{
+		Date:    EpidemicStart,
+		Measure: Complete,
+		List:    []InfectionStatus{{Date: EpidemicStart, Prefecture: "神奈川県", InfectionNumberDaily: 1, InfectionNumberCumulatively: 1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch() = %+v, want %+v", got, want)
+	}
+
+	got, err = s.Fetch(context.Background(), date(2020, 1, 17))
+	if err != nil || got.Measure != Daily {
+		t.Errorf("Fetch() = %+v, %v, want daily only", got, err)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	csv := &CSVSource{Location: "testdata/newly_confirmed_cases_daily.csv"}
+	api := &APISource{Fetcher: fileFetcher{}}
+
+	t.Run("Use next source when no data", func(t *testing.T) {
+		got, err := Fallback{api, csv}.Fetch(context.Background(), date(2023, 1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Measure != Daily || len(got.List) != 2 {
+			t.Errorf("Fetch() = %+v, want csv data", got)
+		}
+	})
+
+	t.Run("Use next source when unavailable", func(t *testing.T) {
+		got, err := Fallback{errSource{errors.New("timeout")}, csv}.Fetch(context.Background(), date(2023, 1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.List) != 2 {
+			t.Errorf("Fetch() = %+v, want csv data", got)
+		}
+	})
+
+	t.Run("Report error when all sources fail", func(t *testing.T) {
+		want := errors.New("timeout")
+		_, err := Fallback{errSource{want}, api}.Fetch(context.Background(), date(2023, 1, 2))
+		if err != want {
+			t.Errorf("Fetch() error = %v, want %v", err, want)
+		}
+	})
+}
+
+func TestNewSource(t *testing.T) {
+	t.Setenv("ARCHIVE", "")
+	t.Setenv("SOURCE", "csv")
+	t.Setenv("OPENDATA_TIMEOUT", "5s")
+
+	source, err := NewSource(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv, ok := source.(*CSVSource)
+	if !ok || csv.HTTPClient == nil || csv.HTTPClient.Timeout != 5*time.Second {
+		t.Errorf("NewSource() = %#v, want csv source with OPENDATA_TIMEOUT", source)
+	}
+
+	if _, err := NewSource(context.Background(), true); !errors.Is(err, ErrReplayWithoutArchive) {
+		t.Errorf("NewSource() error = %v, want ErrReplayWithoutArchive", err)
+	}
+}
@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// 登録先の読み書き
+// IngesterのStorageが未指定の場合はDBを使う（テストではメモリ上の実装に差し替える）
+type Storage interface {
+	// 指定日の都道府県別（全国を含む）の累積感染者数
+	Cumulatives(ctx context.Context, date time.Time) (map[string]int, error)
+	// 1日分を登録・更新し、全国の行を再集計する
+	Upsert(ctx context.Context, infectionStatusList []InfectionStatus, recordedAt time.Time) (Result, error)
+	// 一括登録のジョブごとの登録済みの最終日（未登録の場合はnil）
+	Checkpoint(ctx context.Context, job string) (*time.Time, error)
+	SaveCheckpoint(ctx context.Context, job string, date time.Time) error
+	DeleteCheckpoint(ctx context.Context, job string) error
+}
+
+type SQLStorage struct {
+	DB *sql.DB
+}
+
+func (s SQLStorage) Cumulatives(ctx context.Context, date time.Time) (map[string]int, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT prefecture, infection_number_cumulatively FROM infection_status WHERE date = ?", date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[string]int)
+	for rows.Next() {
+		var prefecture string
+		var cumulative int
+		if err := rows.Scan(&prefecture, &cumulative); err != nil {
+			return nil, err
+		}
+		m[prefecture] = cumulative
+	}
+	return m, rows.Err()
+}
+
+func (s SQLStorage) Upsert(ctx context.Context, infectionStatusList []InfectionStatus, recordedAt time.Time) (Result, error) {
+	return Upsert(ctx, s.DB, infectionStatusList, recordedAt)
+}
+
+func (s SQLStorage) Checkpoint(ctx context.Context, job string) (*time.Time, error) {
+	var last time.Time
+	err := s.DB.QueryRowContext(ctx, "SELECT last_date FROM infection_status_checkpoint WHERE job = ?", job).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &last, nil
+}
+
+func (s SQLStorage) SaveCheckpoint(ctx context.Context, job string, date time.Time) error {
+	_, err := s.DB.ExecContext(ctx, "INSERT INTO infection_status_checkpoint (job, last_date) VALUES (?, ?) ON DUPLICATE KEY UPDATE last_date = VALUES(last_date)", job, date)
+	return err
+}
+
+func (s SQLStorage) DeleteCheckpoint(ctx context.Context, job string) error {
+	_, err := s.DB.ExecContext(ctx, "DELETE FROM infection_status_checkpoint WHERE job = ?", job)
+	return err
+}
@@ -0,0 +1,337 @@
+// opendata.corona.go.jp のAPIクライアント
+// https://corona.go.jp/dashboard/
+package opendata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultTimeout     = 30 * time.Second
+	DefaultMaxRetries  = 3
+	DefaultBaseBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff  = 10 * time.Second
+	DefaultUserAgent   = "ca-geo-corona (+https://github.com/tsuvic/ca-geo-corona)"
+
+	Covid19JapanAllURL    = "https://opendata.corona.go.jp/api/Covid19JapanAll"
+	Covid19DailySurveyURL = "https://opendata.corona.go.jp/api/covid19DailySurvey"
+)
+
+var (
+	ErrNon200Response = errors.New("non 200 Response found")
+	ErrNoJsonResponse = errors.New("no JsonResponse in HTTP response")
+)
+
+// 200以外のレスポンス
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", ErrNon200Response, e.StatusCode, e.URL)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrNon200Response
+}
+
+// 外部APIの失敗としてBad Gatewayで返却する
+func (e *StatusError) Upstream() bool {
+	return true
+}
+
+// レスポンスのerrorInfoでエラーが返却された場合
+type APIError struct {
+	URL          string
+	ErrorCode    string
+	ErrorMessage string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("opendata api error: code=%s message=%s %s", e.ErrorCode, e.ErrorMessage, e.URL)
+}
+
+func (e *APIError) Upstream() bool {
+	return true
+}
+
+// 指定した条件のデータが存在しないことを表すエラーコード
+var NoDataErrorCodes = []string{"E100"}
+
+// データが存在しない（APIの障害・リクエストの誤りではない）
+func (e *APIError) NoData() bool {
+	for _, code := range NoDataErrorCodes {
+		if e.ErrorCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+type ErrorInfo struct {
+	ErrorFlag    string `json:"errorFlag"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// errorFlagは正常時"0"
+func (e ErrorInfo) failed() bool {
+	return e.ErrorFlag != "" && e.ErrorFlag != "0"
+}
+
+type Covid19JapanAllResponse struct {
+	ErrorInfo ErrorInfo             `json:"errorInfo"`
+	ItemList  []Covid19JapanAllItem `json:"itemList"`
+}
+
+type Covid19JapanAllItem struct {
+	Date      string `json:"date"`
+	NameJp    string `json:"name_jp"`
+	NPatients string `json:"npatients"`
+}
+
+type DailySurveyItem struct {
+	FacilityId   string `json:"facilityId"`
+	FacilityName string `json:"facilityName"`
+	ZipCode      string `json:"zipCode"`
+	PrefName     string `json:"prefName"`
+	FacilityAddr string `json:"facilityAddr"`
+	FacilityTel  string `json:"facilityTel"`
+	Latitude     string `json:"latitude"`
+	Longitude    string `json:"longitude"`
+	SubmitDate   string `json:"submitDate"`
+	LocalGovCode string `json:"localGovCode"`
+	CityName     string `json:"cityName"`
+	FacilityCode string `json:"facilityCode"`
+	FacilityType string `json:"facilityType"`
+	AnsType      string `json:"ansType"`
+}
+
+type Options struct {
+	Covid19JapanAllURL    string
+	Covid19DailySurveyURL string
+	Timeout               time.Duration
+	MaxRetries            int
+	BaseBackoff           time.Duration
+	MaxBackoff            time.Duration
+	UserAgent             string
+	Transport             http.RoundTripper
+	HTTPClient            *http.Client
+}
+
+// 環境変数 OPENDATA_TIMEOUT, OPENDATA_MAX_RETRIES で上書きできる
+func OptionsFromEnv() Options {
+	var opts Options
+	if d, err := time.ParseDuration(os.Getenv("OPENDATA_TIMEOUT")); err == nil {
+		opts.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("OPENDATA_MAX_RETRIES")); err == nil {
+		opts.MaxRetries = n
+	}
+	return opts
+}
+
+// TimeoutとTransportからHTTPクライアントを作成する（Timeout未指定の場合はDefaultTimeout）
+func (opts Options) NewHTTPClient() *http.Client {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{Timeout: timeout, Transport: opts.Transport}
+}
+
+type Client struct {
+	covid19JapanAllURL    string
+	covid19DailySurveyURL string
+	httpClient            *http.Client
+	maxRetries            int
+	baseBackoff           time.Duration
+	maxBackoff            time.Duration
+	userAgent             string
+}
+
+func NewClient(opts Options) *Client {
+	c := &Client{
+		covid19JapanAllURL:    opts.Covid19JapanAllURL,
+		covid19DailySurveyURL: opts.Covid19DailySurveyURL,
+		httpClient:            opts.HTTPClient,
+		maxRetries:            opts.MaxRetries,
+		baseBackoff:           opts.BaseBackoff,
+		maxBackoff:            opts.MaxBackoff,
+		userAgent:             opts.UserAgent,
+	}
+	if c.covid19JapanAllURL == "" {
+		c.covid19JapanAllURL = Covid19JapanAllURL
+	}
+	if c.covid19DailySurveyURL == "" {
+		c.covid19DailySurveyURL = Covid19DailySurveyURL
+	}
+	if c.httpClient == nil {
+		c.httpClient = opts.NewHTTPClient()
+	}
+	if c.maxRetries < 0 {
+		c.maxRetries = 0
+	} else if c.maxRetries == 0 {
+		c.maxRetries = DefaultMaxRetries
+	}
+	if c.baseBackoff <= 0 {
+		c.baseBackoff = DefaultBaseBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = DefaultMaxBackoff
+	}
+	if c.userAgent == "" {
+		c.userAgent = DefaultUserAgent
+	}
+	return c
+}
+
+// 日付を指定して都道府県別の累積感染者数を取得する
+func (c *Client) Covid19JapanAll(ctx context.Context, date time.Time) (*Covid19JapanAllResponse, error) {
+	query := url.Values{}
+	query.Add("date", date.Format("20060102"))
+
+	endpoint, err := withQuery(c.covid19JapanAllURL, query)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.get(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	//https://budougumi0617.github.io/2019/02/24/go-print-detail-of-json-syntax-error/
+	var res Covid19JapanAllResponse
+	if err = json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if res.ErrorInfo.failed() {
+		return nil, &APIError{URL: endpoint, ErrorCode: res.ErrorInfo.ErrorCode, ErrorMessage: res.ErrorInfo.ErrorMessage}
+	}
+	return &res, nil
+}
+
+// 医療機関の稼働状況を取得する
+func (c *Client) Covid19DailySurvey(ctx context.Context, query url.Values) ([]DailySurveyItem, error) {
+	endpoint, err := withQuery(c.covid19DailySurveyURL, query)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.get(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	//エラー時は配列ではなくerrorInfoを持つオブジェクトが返却される
+	var items []DailySurveyItem
+	if err = json.Unmarshal(body, &items); err != nil {
+		var res struct {
+			ErrorInfo ErrorInfo `json:"errorInfo"`
+		}
+		if json.Unmarshal(body, &res) == nil && res.ErrorInfo.failed() {
+			return nil, &APIError{URL: endpoint, ErrorCode: res.ErrorInfo.ErrorCode, ErrorMessage: res.ErrorInfo.ErrorMessage}
+		}
+		return nil, err
+	}
+	return items, nil
+}
+
+func withQuery(endpoint string, query url.Values) (string, error) {
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := base.Query()
+	for key, vals := range query {
+		for _, val := range vals {
+			q.Add(key, val)
+		}
+	}
+	base.RawQuery = q.Encode()
+	return base.String(), nil
+}
+
+// 5xx・通信エラーはジッター付き指数バックオフでリトライする
+func (c *Client) get(ctx context.Context, endpoint string) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		}
+
+		body, retry, err := c.do(ctx, endpoint)
+		if err == nil {
+			return body, nil
+		}
+		if !retry {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (c *Client) do(ctx context.Context, endpoint string) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		return nil, retry, &StatusError{URL: endpoint, StatusCode: res.StatusCode}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	if len(body) == 0 {
+		return nil, false, ErrNoJsonResponse
+	}
+	return body, false, nil
+}
+
+// https://aws.amazon.com/jp/blogs/architecture/exponential-backoff-and-jitter/
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.baseBackoff << (attempt - 1)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
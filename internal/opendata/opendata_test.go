@@ -0,0 +1,151 @@
+package opendata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(url string) *Client {
+	return NewClient(Options{
+		Covid19JapanAllURL:    url,
+		Covid19DailySurveyURL: url,
+		Timeout:               time.Second,
+		MaxRetries:            2,
+		BaseBackoff:           time.Millisecond,
+		MaxBackoff:            5 * time.Millisecond,
+	})
+}
+
+func TestCovid19JapanAll(t *testing.T) {
+	t.Run("Retry on 5xx", func(t *testing.T) {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(503)
+				return
+			}
+			if r.URL.Query().Get("date") != "20230101" {
+				t.Errorf("date = %s, want 20230101", r.URL.Query().Get("date"))
+			}
+			if r.Header.Get("User-Agent") != DefaultUserAgent {
+				t.Errorf("User-Agent = %s", r.Header.Get("User-Agent"))
+			}
+			fmt.Fprint(w, `{"errorInfo":{"errorFlag":"0","errorCode":null,"errorMessage":null},"itemList":[{"date":"2023-01-01","name_jp":"東京都","npatients":"100"}]}`)
+		}))
+		defer ts.Close()
+
+		res, err := newTestClient(ts.URL).Covid19JapanAll(context.Background(), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+		if len(res.ItemList) != 1 || res.ItemList[0].NPatients != "100" {
+			t.Errorf("ItemList = %#v", res.ItemList)
+		}
+	})
+
+	t.Run("Give up after retries", func(t *testing.T) {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(500)
+		}))
+		defer ts.Close()
+
+		_, err := newTestClient(ts.URL).Covid19JapanAll(context.Background(), time.Now())
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != 500 {
+			t.Fatalf("err = %v, want StatusError 500", err)
+		}
+		if !errors.Is(err, ErrNon200Response) {
+			t.Errorf("err = %v, want ErrNon200Response", err)
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+
+	t.Run("No retry on 4xx", func(t *testing.T) {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(404)
+		}))
+		defer ts.Close()
+
+		_, err := newTestClient(ts.URL).Covid19JapanAll(context.Background(), time.Now())
+		if !errors.Is(err, ErrNon200Response) {
+			t.Fatalf("err = %v, want ErrNon200Response", err)
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+
+	t.Run("ErrorInfo", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"errorInfo":{"errorFlag":"1","errorCode":"E001","errorMessage":"invalid date"},"itemList":[]}`)
+		}))
+		defer ts.Close()
+
+		_, err := newTestClient(ts.URL).Covid19JapanAll(context.Background(), time.Now())
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("err = %v, want APIError", err)
+		}
+		if apiErr.ErrorCode != "E001" || apiErr.ErrorMessage != "invalid date" || apiErr.NoData() {
+			t.Errorf("APIError = %#v", apiErr)
+		}
+	})
+
+	t.Run("Empty body", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer ts.Close()
+
+		_, err := newTestClient(ts.URL).Covid19JapanAll(context.Background(), time.Now())
+		if !errors.Is(err, ErrNoJsonResponse) {
+			t.Fatalf("err = %v, want ErrNoJsonResponse", err)
+		}
+	})
+}
+
+func TestCovid19DailySurvey(t *testing.T) {
+	t.Run("Keep query in URL", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("localGovCode") != "012025" {
+				t.Errorf("localGovCode = %s", r.URL.Query().Get("localGovCode"))
+			}
+			fmt.Fprint(w, `[{"facilityId":"1","facilityType":"入院","ansType":"通常"}]`)
+		}))
+		defer ts.Close()
+
+		items, err := newTestClient(ts.URL+"?localGovCode=012025").Covid19DailySurvey(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].FacilityType != "入院" {
+			t.Errorf("items = %#v", items)
+		}
+	})
+
+	t.Run("ErrorInfo", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"errorInfo":{"errorFlag":"2","errorCode":"E100","errorMessage":"no data"}}`)
+		}))
+		defer ts.Close()
+
+		_, err := newTestClient(ts.URL).Covid19DailySurvey(context.Background(), nil)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode != "E100" || !apiErr.NoData() {
+			t.Fatalf("err = %v, want APIError E100", err)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+// キーセット方式のカーソルページング
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	DefaultLimit = 1000
+	MaxLimit     = 5000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ソート順。Columnsの組み合わせで行が一意になること
+type Sort struct {
+	Name    string
+	Columns []string
+	Desc    bool
+}
+
+// sort=の指定値（降順は先頭に-）
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Name
+	}
+	return s.Name
+}
+
+type Page struct {
+	Sort  Sort
+	Limit int
+	// カーソル位置の行のキー（Sort.Columnsの順）。先頭ページはnil
+	After []string
+}
+
+type cursor struct {
+	Sort string   `json:"s"`
+	Keys []string `json:"k"`
+}
+
+// sort・limit・cursorの指定を解釈する。sort未指定の場合はsortsの先頭
+func Parse(sorts []Sort, sort, limit, token string) (Page, error) {
+	var p Page
+	if sort == "" {
+		p.Sort = sorts[0]
+	} else {
+		name := strings.TrimPrefix(sort, "-")
+		found := false
+		for _, s := range sorts {
+			if s.Name == name {
+				p.Sort = Sort{Name: s.Name, Columns: s.Columns, Desc: strings.HasPrefix(sort, "-")}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return p, fmt.Errorf("unknown sort: %s", sort)
+		}
+	}
+
+	p.Limit = DefaultLimit
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return p, fmt.Errorf("invalid limit: %s (want 1-%d)", limit, MaxLimit)
+		}
+		p.Limit = n
+	}
+
+	if token != "" {
+		c, err := decode(token)
+		if err != nil || c.Sort != p.Sort.String() || len(c.Keys) != len(p.Sort.Columns) {
+			return p, ErrInvalidCursor
+		}
+		p.After = c.Keys
+	}
+	return p, nil
+}
+
+// カーソル位置より後ろの行の検索条件
+// (c1 > ? OR (c1 = ? AND c2 > ?)) の形で展開する
+func (p Page) Where() (string, []interface{}) {
+	if p.After == nil {
+		return "", nil
+	}
+	op := ">"
+	if p.Sort.Desc {
+		op = "<"
+	}
+
+	var clauses []string
+	var args []interface{}
+	for i, column := range p.Sort.Columns {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, p.Sort.Columns[j]+" = ?")
+			args = append(args, p.After[j])
+		}
+		terms = append(terms, column+" "+op+" ?")
+		args = append(args, p.After[i])
+		clauses = append(clauses, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+// 次ページの有無を判定するため1行多く取得する
+func (p Page) OrderBy() string {
+	dir := "ASC"
+	if p.Sort.Desc {
+		dir = "DESC"
+	}
+	orders := make([]string, len(p.Sort.Columns))
+	for i, column := range p.Sort.Columns {
+		orders[i] = column + " " + dir
+	}
+	return fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(orders, ", "), p.Limit+1)
+}
+
+// 最終行のキーから次ページのカーソルを作成する
+func (p Page) Next(keys []string) string {
+	b, _ := json.Marshal(cursor{Sort: p.Sort.String(), Keys: keys})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(token string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// リクエストのクエリパラメータ（Linkヘッダーの作成用）
+// MultiValueQueryStringParametersのみ、QueryStringParametersのみのどちらのリクエストでも全パラメータを引き継ぐ
+func RequestQuery(req events.APIGatewayProxyRequest) url.Values {
+	query := url.Values{}
+	for key, vals := range req.MultiValueQueryStringParameters {
+		query[key] = vals
+	}
+	for key, val := range req.QueryStringParameters {
+		if _, ok := query[key]; !ok {
+			query.Set(key, val)
+		}
+	}
+	return query
+}
+
+// 次ページのLinkヘッダー（RFC 8288）
+// クエリパラメータはそのままにcursorのみ置き換える
+func Link(path string, query url.Values, token string) string {
+	next := url.Values{}
+	for key, vals := range query {
+		if key != "cursor" {
+			next[key] = vals
+		}
+	}
+	next.Set("cursor", token)
+	return fmt.Sprintf("<%s?%s>; rel=\"next\"", path, next.Encode())
+}
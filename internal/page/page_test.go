@@ -0,0 +1,117 @@
+package page
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var sorts = []Sort{
+	{Name: "date", Columns: []string{"date", "prefecture"}},
+	{Name: "prefecture", Columns: []string{"prefecture", "date"}},
+}
+
+func TestParse(t *testing.T) {
+	next := Page{Sort: Sort{Name: "date", Columns: []string{"date", "prefecture"}, Desc: true}}.Next([]string{"2023-01-01", "東京都"})
+	tests := []struct {
+		name    string
+		sort    string
+		limit   string
+		token   string
+		want    Page
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: Page{Sort: sorts[0], Limit: DefaultLimit},
+		},
+		{
+			name:  "desc with cursor",
+			sort:  "-date",
+			limit: "10",
+			token: next,
+			want:  Page{Sort: Sort{Name: "date", Columns: []string{"date", "prefecture"}, Desc: true}, Limit: 10, After: []string{"2023-01-01", "東京都"}},
+		},
+		{
+			name:    "cursor for another sort",
+			sort:    "date",
+			token:   next,
+			wantErr: true,
+		},
+		{
+			name:    "broken cursor",
+			token:   "!!!",
+			wantErr: true,
+		},
+		{
+			name:    "unknown sort",
+			sort:    "city",
+			wantErr: true,
+		},
+		{
+			name:    "limit too large",
+			limit:   "5001",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(sorts, tt.sort, tt.limit, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse(sorts, "", "", "!!!"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Parse() error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestClause(t *testing.T) {
+	p := Page{Sort: Sort{Name: "date", Columns: []string{"date", "prefecture"}, Desc: true}, Limit: 10}
+	if where, args := p.Where(); where != "" || args != nil {
+		t.Errorf("Where() = %q, %v", where, args)
+	}
+
+	p.After = []string{"2023-01-01", "東京都"}
+	where, args := p.Where()
+	if want := "((date < ?) OR (date = ? AND prefecture < ?))"; where != want {
+		t.Errorf("Where() = %q, want %q", where, want)
+	}
+	if want := []interface{}{"2023-01-01", "2023-01-01", "東京都"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Where() args = %v, want %v", args, want)
+	}
+	if got, want := p.OrderBy(), " ORDER BY date DESC, prefecture DESC LIMIT 11"; got != want {
+		t.Errorf("OrderBy() = %q, want %q", got, want)
+	}
+}
+
+func TestLink(t *testing.T) {
+	query := url.Values{"prefecture": {"東京都"}, "cursor": {"old"}, "limit": {"10"}}
+	got := Link("/infectionStatus/daily", query, "next")
+	want := `</infectionStatus/daily?cursor=next&limit=10&prefecture=%E6%9D%B1%E4%BA%AC%E9%83%BD>; rel="next"`
+	if got != want {
+		t.Errorf("Link() = %s, want %s", got, want)
+	}
+}
+
+func TestRequestQuery(t *testing.T) {
+	req := events.APIGatewayProxyRequest{
+		QueryStringParameters:           map[string]string{"prefName": "東京都", "limit": "10", "sort": "-submitDate"},
+		MultiValueQueryStringParameters: map[string][]string{"prefName": {"東京都", "大阪府"}, "limit": {"10"}},
+	}
+	want := url.Values{"prefName": {"東京都", "大阪府"}, "limit": {"10"}, "sort": {"-submitDate"}}
+	if got := RequestQuery(req); !reflect.DeepEqual(got, want) {
+		t.Errorf("RequestQuery() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package prefecture
+
+// 令和2年国勢調査の人口（都道府県コード順）
+// https://www.stat.go.jp/data/kokusei/2020/
+var Populations = []int{
+	5224614, 1237984, 1210534, 2301996, 959502, 1068027, 1833152,
+	2867009, 1933146, 1939110, 7344765, 6284480, 14047594, 9237337,
+	2201272, 1034814, 1132526, 766863, 809974, 2048011, 1978742, 3633202, 7542415,
+	1770254, 1413610, 2578087, 8837685, 5465002, 1324473, 922584,
+	553407, 671126, 1888432, 2799702, 1342059,
+	719559, 950244, 1334841, 691527,
+	5135214, 811442, 1312317, 1738301, 1123852, 1069576, 1588256, 1467480,
+}
+
+// 都道府県・地方・全国の人口。存在しない場合は0
+func Population(name string) int {
+	if code := Code(name); code > 0 {
+		return Populations[code-1]
+	}
+
+	var prefectures []string
+	if name == National {
+		prefectures = Names
+	} else if region, ok := LookupRegion(name); ok {
+		prefectures = region.Prefectures
+	}
+	total := 0
+	for _, p := range prefectures {
+		total += Populations[Code(p)-1]
+	}
+	return total
+}
@@ -0,0 +1,65 @@
+// 都道府県の定義
+package prefecture
+
+// 全国合計の行の都道府県名
+const National = "全国"
+
+// 都道府県コード順
+var Names = []string{
+	"北海道", "青森県", "岩手県", "宮城県", "秋田県", "山形県", "福島県",
+	"茨城県", "栃木県", "群馬県", "埼玉県", "千葉県", "東京都", "神奈川県",
+	"新潟県", "富山県", "石川県", "福井県", "山梨県", "長野県", "岐阜県", "静岡県", "愛知県",
+	"三重県", "滋賀県", "京都府", "大阪府", "兵庫県", "奈良県", "和歌山県",
+	"鳥取県", "島根県", "岡山県", "広島県", "山口県",
+	"徳島県", "香川県", "愛媛県", "高知県",
+	"福岡県", "佐賀県", "長崎県", "熊本県", "大分県", "宮崎県", "鹿児島県", "沖縄県",
+}
+
+// 厚生労働省オープンデータの英語表記（都道府県コード順）
+var EnglishNames = []string{
+	"Hokkaido", "Aomori", "Iwate", "Miyagi", "Akita", "Yamagata", "Fukushima",
+	"Ibaraki", "Tochigi", "Gunma", "Saitama", "Chiba", "Tokyo", "Kanagawa",
+	"Niigata", "Toyama", "Ishikawa", "Fukui", "Yamanashi", "Nagano", "Gifu", "Shizuoka", "Aichi",
+	"Mie", "Shiga", "Kyoto", "Osaka", "Hyogo", "Nara", "Wakayama",
+	"Tottori", "Shimane", "Okayama", "Hiroshima", "Yamaguchi",
+	"Tokushima", "Kagawa", "Ehime", "Kochi",
+	"Fukuoka", "Saga", "Nagasaki", "Kumamoto", "Oita", "Miyazaki", "Kagoshima", "Okinawa",
+}
+
+var codes = func() map[string]int {
+	m := make(map[string]int, len(Names))
+	for i, name := range Names {
+		m[name] = i + 1
+	}
+	return m
+}()
+
+var englishCodes = func() map[string]int {
+	m := make(map[string]int, len(EnglishNames))
+	for i, name := range EnglishNames {
+		m[name] = i + 1
+	}
+	return m
+}()
+
+// 都道府県名として正しいか
+func Valid(name string) bool {
+	_, ok := codes[name]
+	return ok
+}
+
+// 都道府県コード（1〜47）。存在しない場合は0
+func Code(name string) int {
+	return codes[name]
+}
+
+// 英語表記・日本語表記から日本語の都道府県名を返す
+func Normalize(name string) (string, bool) {
+	if Valid(name) {
+		return name, true
+	}
+	if code, ok := englishCodes[name]; ok {
+		return Names[code-1], true
+	}
+	return "", false
+}
@@ -0,0 +1,106 @@
+package prefecture
+
+import "testing"
+
+func TestNames(t *testing.T) {
+	if len(Names) != 47 {
+		t.Fatalf("len(Names) = %d, want 47", len(Names))
+	}
+	tests := []struct {
+		name  string
+		valid bool
+		code  int
+	}{
+		{"北海道", true, 1},
+		{"東京都", true, 13},
+		{"沖縄県", true, 47},
+		{"東京", false, 0},
+		{"", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Valid(tt.name); got != tt.valid {
+				t.Errorf("Valid(%q) = %v, want %v", tt.name, got, tt.valid)
+			}
+			if got := Code(tt.name); got != tt.code {
+				t.Errorf("Code(%q) = %d, want %d", tt.name, got, tt.code)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if len(EnglishNames) != len(Names) {
+		t.Fatalf("len(EnglishNames) = %d, want %d", len(EnglishNames), len(Names))
+	}
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"Tokyo", "東京都", true},
+		{"Hokkaido", "北海道", true},
+		{"京都府", "京都府", true},
+		{"ALL", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Normalize(tt.name)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRegions(t *testing.T) {
+	//全都道府県がいずれか1つの地方に属する
+	seen := make(map[string]bool)
+	for _, region := range Regions {
+		for _, name := range region.Prefectures {
+			if !Valid(name) {
+				t.Errorf("%s: unknown prefecture %q", region.Name, name)
+			}
+			if seen[name] {
+				t.Errorf("%s: duplicated prefecture %q", region.Name, name)
+			}
+			seen[name] = true
+		}
+	}
+	if len(seen) != len(Names) {
+		t.Errorf("len(seen) = %d, want %d", len(seen), len(Names))
+	}
+
+	if got := RegionOf("東京都"); got != "関東地方" {
+		t.Errorf("RegionOf(東京都) = %q", got)
+	}
+	if got := RegionOf(National); got != "" {
+		t.Errorf("RegionOf(全国) = %q", got)
+	}
+	if region, ok := LookupRegion("近畿地方"); !ok || len(region.Prefectures) != 6 {
+		t.Errorf("LookupRegion(近畿地方) = %v, %v", region, ok)
+	}
+}
+
+func TestPopulation(t *testing.T) {
+	if len(Populations) != len(Names) {
+		t.Fatalf("len(Populations) = %d, want %d", len(Populations), len(Names))
+	}
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"東京都", 14047594},
+		{"鳥取県", 553407},
+		{"近畿地方", 20541441},
+		{National, 126146099},
+		{"東京", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Population(tt.name); got != tt.want {
+				t.Errorf("Population(%q) = %d, want %d", tt.name, got, tt.want)
+			}
+		})
+	}
+}
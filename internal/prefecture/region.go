@@ -0,0 +1,42 @@
+package prefecture
+
+// 地方区分
+type Region struct {
+	Name        string
+	Prefectures []string
+}
+
+// 地方区分（北から順）
+var Regions = []Region{
+	{"北海道・東北地方", []string{"北海道", "青森県", "岩手県", "宮城県", "秋田県", "山形県", "福島県"}},
+	{"関東地方", []string{"茨城県", "栃木県", "群馬県", "埼玉県", "千葉県", "東京都", "神奈川県"}},
+	{"中部地方", []string{"新潟県", "富山県", "石川県", "福井県", "山梨県", "長野県", "岐阜県", "静岡県", "愛知県", "三重県"}},
+	{"近畿地方", []string{"滋賀県", "京都府", "大阪府", "兵庫県", "奈良県", "和歌山県"}},
+	{"中国・四国地方", []string{"鳥取県", "島根県", "岡山県", "広島県", "山口県", "徳島県", "香川県", "愛媛県", "高知県"}},
+	{"九州・沖縄地方", []string{"福岡県", "佐賀県", "長崎県", "熊本県", "大分県", "宮崎県", "鹿児島県", "沖縄県"}},
+}
+
+var regionOf = func() map[string]string {
+	m := make(map[string]string, len(Names))
+	for _, region := range Regions {
+		for _, name := range region.Prefectures {
+			m[name] = region.Name
+		}
+	}
+	return m
+}()
+
+// 都道府県の属する地方名。存在しない場合は空文字
+func RegionOf(name string) string {
+	return regionOf[name]
+}
+
+// 地方名から地方区分を返す
+func LookupRegion(name string) (Region, bool) {
+	for _, region := range Regions {
+		if region.Name == name {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
@@ -0,0 +1,153 @@
+// RFC 7807 (Problem Details for HTTP APIs) 形式のエラーレスポンス
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const ContentType = "application/problem+json"
+
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// HTTPステータスを指定したエラー
+type Error struct {
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// 外部APIのエラーはUpstream()でtrueを返す
+type upstream interface {
+	Upstream() bool
+}
+
+func newError(status int, format string, a ...interface{}) error {
+	return &Error{Status: status, Err: fmt.Errorf(format, a...)}
+}
+
+// リクエストパラメータの誤り
+func BadRequest(format string, a ...interface{}) error {
+	return newError(http.StatusBadRequest, format, a...)
+}
+
+func NotFound(format string, a ...interface{}) error {
+	return newError(http.StatusNotFound, format, a...)
+}
+
+func NotAcceptable(format string, a ...interface{}) error {
+	return newError(http.StatusNotAcceptable, format, a...)
+}
+
+// 外部APIの失敗
+func Upstream(err error) error {
+	return &Error{Status: http.StatusBadGateway, Err: err}
+}
+
+// DBに接続できない
+func Database(err error) error {
+	return &Error{Status: http.StatusServiceUnavailable, Err: err}
+}
+
+// errに対応するHTTPステータス
+func Status(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Status >= 500 && errors.Is(err, context.DeadlineExceeded) {
+			return http.StatusGatewayTimeout
+		}
+		return e.Status
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	var u upstream
+	if errors.As(err, &u) && u.Upstream() {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// errをproblem+jsonのレスポンスに変換する
+// 5xxの詳細は返却せずログにのみ出力する
+func Response(ctx context.Context, req events.APIGatewayProxyRequest, err error) events.APIGatewayProxyResponse {
+	status := Status(err)
+	p := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  req.Path,
+		RequestID: requestID(ctx, req),
+	}
+	if status < 500 {
+		p.Detail = err.Error()
+	} else {
+		log.Printf("requestId=%s status=%d error=%v", p.RequestID, status, err)
+	}
+
+	body, _ := json.Marshal(p)
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": ContentType},
+		Body:       string(body),
+	}
+}
+
+func requestID(ctx context.Context, req events.APIGatewayProxyRequest) string {
+	if req.RequestContext.RequestID != "" {
+		return req.RequestContext.RequestID
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
+
+type Handler func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// panicをエラーに変換し、Lambdaのプロセスを終了させない
+func Recover(h Handler) Handler {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (res events.APIGatewayProxyResponse, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("panic: %v\n%s", r, debug.Stack())
+				res, err = events.APIGatewayProxyResponse{}, fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return h(ctx, req)
+	}
+}
+
+// API Gateway用。エラー・panicをproblem+jsonのレスポンスとして返却する
+func Wrap(h Handler) Handler {
+	h = Recover(h)
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		res, err := h(ctx, req)
+		if err != nil {
+			return Response(ctx, req, err), nil
+		}
+		return res, nil
+	}
+}
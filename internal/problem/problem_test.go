@@ -0,0 +1,110 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type upstreamError struct{}
+
+func (upstreamError) Error() string  { return "upstream" }
+func (upstreamError) Upstream() bool { return true }
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"bad request", BadRequest("invalid date: %s", "x"), 400},
+		{"not found", NotFound("unknown type"), 404},
+		{"wrapped", fmt.Errorf("get: %w", NotAcceptable("text/html")), 406},
+		{"upstream", fmt.Errorf("fetch: %w", upstreamError{}), 502},
+		{"upstream timeout", Upstream(context.DeadlineExceeded), 504},
+		{"database", Database(errors.New("connection refused")), 503},
+		{"timeout", context.DeadlineExceeded, 504},
+		{"other", errors.New("boom"), 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Status(tt.err); got != tt.want {
+				t.Errorf("Status() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	req := events.APIGatewayProxyRequest{
+		Path:           "/infectionStatus/daily",
+		RequestContext: events.APIGatewayProxyRequestContext{RequestID: "req-1"},
+	}
+	tests := []struct {
+		name    string
+		handler Handler
+		want    Problem
+	}{
+		{
+			name: "bad request",
+			handler: func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{}, BadRequest("invalid date: %q", "2023/01/01")
+			},
+			want: Problem{Type: "about:blank", Title: "Bad Request", Status: 400, Detail: `invalid date: "2023/01/01"`, Instance: "/infectionStatus/daily", RequestID: "req-1"},
+		},
+		{
+			name: "internal error hides detail",
+			handler: func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{}, errors.New("dial tcp 10.0.0.1:3306")
+			},
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Instance: "/infectionStatus/daily", RequestID: "req-1"},
+		},
+		{
+			name: "panic",
+			handler: func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				panic("nil map")
+			},
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Instance: "/infectionStatus/daily", RequestID: "req-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Wrap(tt.handler)(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want.Status || res.Headers["Content-Type"] != ContentType {
+				t.Errorf("Wrap() = %d %v", res.StatusCode, res.Headers)
+			}
+			var got Problem
+			if err := json.Unmarshal([]byte(res.Body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Wrap() body = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("success", func(t *testing.T) {
+		res, err := Wrap(func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return events.APIGatewayProxyResponse{StatusCode: 200, Body: "[]"}, nil
+		})(context.Background(), req)
+		if err != nil || res.StatusCode != 200 || res.Body != "[]" {
+			t.Errorf("Wrap() = %v, %v", res, err)
+		}
+	})
+}
+
+func TestRecover(t *testing.T) {
+	_, err := Recover(func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		panic("boom")
+	})(context.Background(), events.APIGatewayProxyRequest{})
+	if err == nil || err.Error() != "panic: boom" {
+		t.Errorf("Recover() error = %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+// 一覧のJSON・CSV・NDJSON出力
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	JSON   = "json"
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrNotAcceptable = errors.New("not acceptable")
+)
+
+// Excelで文字化けしないよう先頭に付けるUTF-8のBOM
+const bom = "\ufeff"
+
+var mediaTypes = map[string]string{
+	JSON:   "application/json; charset=utf-8",
+	CSV:    "text/csv; charset=utf-8",
+	NDJSON: "application/x-ndjson; charset=utf-8",
+}
+
+func ContentType(format string) string {
+	return mediaTypes[format]
+}
+
+// format=の指定を優先し、未指定の場合はAcceptヘッダーから出力形式を決める
+func Negotiate(format, accept string) (string, error) {
+	if format != "" {
+		if _, ok := mediaTypes[format]; !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+		}
+		return format, nil
+	}
+	if strings.TrimSpace(accept) == "" {
+		return JSON, nil
+	}
+
+	type mediaRange struct {
+		format string
+		q      float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		q := 1.0
+		for _, param := range params[1:] {
+			if key, val, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "q" {
+				if f, err := strconv.ParseFloat(val, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		var f string
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case "text/csv":
+			f = CSV
+		case "application/x-ndjson", "application/ndjson":
+			f = NDJSON
+		case "application/json", "application/*", "*/*":
+			f = JSON
+		}
+		if f != "" && q > 0 {
+			ranges = append(ranges, mediaRange{format: f, q: q})
+		}
+	}
+	if len(ranges) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNotAcceptable, accept)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	return ranges[0].format, nil
+}
+
+// rowsは構造体のスライス。CSVの列名はjsonタグの名前を使う
+// withBOMはCSVの場合のみ有効
+func Render(format string, rows interface{}, withBOM bool) ([]byte, error) {
+	switch format {
+	case JSON:
+		return json.Marshal(rows)
+	case NDJSON:
+		return renderNDJSON(rows)
+	case CSV:
+		return renderCSV(rows, withBOM)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+func renderNDJSON(rows interface{}) ([]byte, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("render: %T is not a slice", rows)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.Encode(v.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type column struct {
+	name      string
+	index     []int
+	omitempty bool
+}
+
+// jsonタグから列を決める（埋め込み構造体の項目を含む）
+func columns(t reflect.Type) []column {
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for _, c := range columns(f.Type) {
+				c.index = append([]int{i}, c.index...)
+				cols = append(cols, c)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		cols = append(cols, column{name: name, index: []int{i}, omitempty: strings.Contains(opts, "omitempty")})
+	}
+	return cols
+}
+
+func renderCSV(rows interface{}, withBOM bool) ([]byte, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("render: %T is not a slice of struct", rows)
+	}
+
+	//omitemptyの列は全行が空の場合のみ省略する
+	var cols []column
+	for _, c := range columns(v.Type().Elem()) {
+		if c.omitempty {
+			empty := true
+			for i := 0; i < v.Len() && empty; i++ {
+				empty = v.Index(i).FieldByIndex(c.index).IsZero()
+			}
+			if empty {
+				continue
+			}
+		}
+		cols = append(cols, c)
+	}
+
+	var buf bytes.Buffer
+	if withBOM {
+		buf.WriteString(bom)
+	}
+	w := csv.NewWriter(&buf)
+	record := make([]string, len(cols))
+	for i, c := range cols {
+		record[i] = c.name
+	}
+	if err := w.Write(record); err != nil {
+		return nil, err
+	}
+	for i := 0; i < v.Len(); i++ {
+		for j, c := range cols {
+			record[j] = format(v.Index(i).FieldByIndex(c.index))
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,106 @@
+package render
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type row struct {
+	Date  time.Time `json:"date"`
+	Name  string    `json:"name"`
+	Count int       `json:"count"`
+	Rate  *float64  `json:"rate,omitempty"`
+	Note  *string   `json:"note,omitempty"`
+}
+
+type versionRow struct {
+	row
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		accept  string
+		want    string
+		wantErr error
+	}{
+		{name: "default", want: JSON},
+		{name: "format wins", format: "csv", accept: "application/json", want: CSV},
+		{name: "unknown format", format: "xml", wantErr: ErrUnknownFormat},
+		{name: "csv", accept: "text/csv", want: CSV},
+		{name: "ndjson", accept: "application/x-ndjson", want: NDJSON},
+		{name: "quality", accept: "application/json;q=0.5, text/csv", want: CSV},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: JSON},
+		{name: "not acceptable", accept: "text/html", wantErr: ErrNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Negotiate(tt.format, tt.accept)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Negotiate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Negotiate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	rate := 1.5
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []row{
+		{Date: date, Name: "東京都", Count: 10, Rate: &rate},
+		{Date: date, Name: "a \"quoted\", name", Count: 2},
+	}
+	tests := []struct {
+		name    string
+		format  string
+		rows    interface{}
+		withBOM bool
+		want    string
+	}{
+		{
+			name:   "csv",
+			format: CSV,
+			rows:   rows,
+			want: "date,name,count,rate\n" +
+				"2023-01-01T00:00:00Z,東京都,10,1.5\n" +
+				"2023-01-01T00:00:00Z,\"a \"\"quoted\"\", name\",2,\n",
+		},
+		{
+			name:    "csv with bom",
+			format:  CSV,
+			rows:    []row{},
+			withBOM: true,
+			want:    "\ufeffdate,name,count\n",
+		},
+		{
+			name:   "csv embedded",
+			format: CSV,
+			rows:   []versionRow{{row: rows[0], RecordedAt: date}},
+			want:   "date,name,count,rate,recordedAt\n2023-01-01T00:00:00Z,東京都,10,1.5,2023-01-01T00:00:00Z\n",
+		},
+		{
+			name:   "ndjson",
+			format: NDJSON,
+			rows:   rows,
+			want: `{"date":"2023-01-01T00:00:00Z","name":"東京都","count":10,"rate":1.5}` + "\n" +
+				`{"date":"2023-01-01T00:00:00Z","name":"a \"quoted\", name","count":2}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.format, tt.rows, tt.withBOM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
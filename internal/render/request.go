@@ -0,0 +1,64 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+)
+
+// ヘッダー名の大文字・小文字は区別しない
+func Header(req events.APIGatewayProxyRequest, key string) string {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	for k, v := range req.MultiValueHeaders {
+		if strings.EqualFold(k, key) {
+			return strings.Join(v, ", ")
+		}
+	}
+	return ""
+}
+
+// 出力形式はformat=（json|csv|ndjson）、未指定の場合はAcceptヘッダーで決める
+// 指定誤りはproblemのエラー（406、400）として返す
+func FromRequest(req events.APIGatewayProxyRequest) (string, error) {
+	format, err := Negotiate(req.QueryStringParameters["format"], Header(req, "Accept"))
+	if errors.Is(err, ErrNotAcceptable) {
+		return "", problem.NotAcceptable("%s", err)
+	}
+	if err != nil {
+		return "", problem.BadRequest("%s", err)
+	}
+	if bom := req.QueryStringParameters["bom"]; bom != "" && bom != "true" && bom != "false" {
+		return "", problem.BadRequest("invalid bom: %s", bom)
+	}
+	return format, nil
+}
+
+// JSONはbody、CSV・NDJSONは行の一覧rowsを出力する
+// bom=trueの場合、CSVの先頭にBOMを付ける（Excel用）
+func Respond(req events.APIGatewayProxyRequest, body interface{}, rows interface{}) (events.APIGatewayProxyResponse, error) {
+	format, err := FromRequest(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if format != JSON {
+		body = rows
+	}
+	bytes, err := Render(format, body, req.QueryStringParameters["bom"] == "true")
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	fmt.Printf("Body Size : %d Byte \n", len(bytes))
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": ContentType(format)},
+		Body:       string(bytes),
+	}, nil
+}
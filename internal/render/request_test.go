@@ -0,0 +1,69 @@
+package render
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tsuvic/ca-geo-corona/internal/problem"
+)
+
+func TestRespond(t *testing.T) {
+	list := []row{{Date: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Name: "東京都", Count: 1}}
+	tests := []struct {
+		name            string
+		req             events.APIGatewayProxyRequest
+		wantContentType string
+		wantBody        string
+		wantStatus      int
+	}{
+		{
+			name:            "json",
+			req:             events.APIGatewayProxyRequest{},
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `[{"date":"2023-01-01T00:00:00Z","name":"東京都","count":1}]`,
+		},
+		{
+			name:            "csv with bom",
+			req:             events.APIGatewayProxyRequest{Headers: map[string]string{"accept": "text/csv"}, QueryStringParameters: map[string]string{"bom": "true"}},
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "\ufeffdate,name,count\n2023-01-01T00:00:00Z,東京都,1\n",
+		},
+		{
+			name:            "multi value accept",
+			req:             events.APIGatewayProxyRequest{MultiValueHeaders: map[string][]string{"Accept": {"text/html", "application/x-ndjson"}}},
+			wantContentType: "application/x-ndjson; charset=utf-8",
+			wantBody:        `{"date":"2023-01-01T00:00:00Z","name":"東京都","count":1}` + "\n",
+		},
+		{
+			name:       "invalid bom",
+			req:        events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"format": "csv", "bom": "yes"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "not acceptable",
+			req:        events.APIGatewayProxyRequest{Headers: map[string]string{"Accept": "text/html"}},
+			wantStatus: 406,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Respond(tt.req, list, list)
+			if tt.wantStatus != 0 {
+				if status := problem.Status(err); status != tt.wantStatus {
+					t.Fatalf("Respond() error = %v, status %d, want %d", err, status, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Headers["Content-Type"] != tt.wantContentType {
+				t.Errorf("Respond() Content-Type = %v, want %v", got.Headers["Content-Type"], tt.wantContentType)
+			}
+			if got.Body != tt.wantBody {
+				t.Errorf("Respond() Body = %q, want %q", got.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// 曜日による報告数の変動（月曜日に少なく週半ばに多い）の補正
+package seasonal
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// 曜日別の係数（time.Weekday順、平均1）
+// 補正値は日次感染者数を当日の曜日の係数で割った値
+type Factors [7]float64
+
+// 係数の推定に必要な曜日ごとの比率の数
+const MinRatios = 2
+
+// 連続した日次感染者数（startから1日ずつ、欠損はNaN）から曜日別の係数を推定する
+// 中心化7日移動平均との比率の曜日ごとの中央値を、平均1に正規化する
+// 比率が足りない曜日がある場合、係数が0以下となる場合はfalse
+func Estimate(start time.Time, values []float64) (Factors, bool) {
+	var ratios [7][]float64
+	for t := 3; t+3 < len(values); t++ {
+		var sum float64
+		for i := t - 3; i <= t+3; i++ {
+			sum += values[i]
+		}
+		//欠損日を含む場合はNaN
+		if math.IsNaN(sum) || sum <= 0 {
+			continue
+		}
+		day := start.AddDate(0, 0, t).Weekday()
+		ratios[day] = append(ratios[day], values[t]/(sum/7))
+	}
+
+	var f Factors
+	var total float64
+	for day := range f {
+		if len(ratios[day]) < MinRatios {
+			return Factors{}, false
+		}
+		f[day] = median(ratios[day])
+		if f[day] <= 0 {
+			return Factors{}, false
+		}
+		total += f[day]
+	}
+	for day := range f {
+		f[day] /= total / 7
+	}
+	return f, true
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// dateの日次感染者数の補正値
+func (f Factors) Adjust(date time.Time, value float64) float64 {
+	return value / f[date.Weekday()]
+}
@@ -0,0 +1,80 @@
+package seasonal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// 日曜日から土曜日の報告係数（平均1）
+var weekly = Factors{0.9, 0.6, 1.1, 1.2, 1.15, 1.05, 1.0}
+
+func series(start time.Time, n int, rate float64) []float64 {
+	values := make([]float64, n)
+	for t := range values {
+		values[t] = 1000 * math.Exp(rate*float64(t)) * weekly[start.AddDate(0, 0, t).Weekday()]
+	}
+	return values
+}
+
+func TestEstimate(t *testing.T) {
+	//2023-01-01は日曜日
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		rate float64
+		tol  float64
+	}{
+		{"stable", 0, 1e-9},
+		{"growing", 0.03, 0.02},
+		{"declining", -0.03, 0.02},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := Estimate(start, series(start, 56, tt.rate))
+			if !ok {
+				t.Fatal("Estimate() ok = false")
+			}
+			var total float64
+			for day := range f {
+				total += f[day]
+				if math.Abs(f[day]-weekly[day]) > tt.tol {
+					t.Errorf("%v = %v, want %v", time.Weekday(day), f[day], weekly[day])
+				}
+			}
+			if math.Abs(total-7) > 1e-9 {
+				t.Errorf("sum = %v, want 7", total)
+			}
+		})
+	}
+}
+
+func TestEstimateMissing(t *testing.T) {
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	values := series(start, 28, 0)
+	//欠損日の前後の移動平均は使わない
+	values[10] = math.NaN()
+	f, ok := Estimate(start, values)
+	if !ok {
+		t.Fatal("Estimate() ok = false")
+	}
+	if math.Abs(f[time.Monday]-weekly[time.Monday]) > 1e-9 {
+		t.Errorf("Monday = %v, want %v", f[time.Monday], weekly[time.Monday])
+	}
+
+	//各曜日の比率が2件未満
+	if _, ok := Estimate(start, series(start, 13, 0)); ok {
+		t.Error("Estimate() ok = true for 13 days")
+	}
+	//すべて0
+	if _, ok := Estimate(start, make([]float64, 28)); ok {
+		t.Error("Estimate() ok = true for zeros")
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	monday := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	if got := weekly.Adjust(monday, 600); math.Abs(got-1000) > 1e-9 {
+		t.Errorf("Adjust() = %v, want 1000", got)
+	}
+}
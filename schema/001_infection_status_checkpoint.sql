@@ -0,0 +1,7 @@
+-- 期間指定の一括登録（/infectionStatus/register?from=&to=）の進捗
+CREATE TABLE IF NOT EXISTS infection_status_checkpoint (
+    job        VARCHAR(32) NOT NULL,
+    last_date  DATE        NOT NULL,
+    updated_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (job)
+);
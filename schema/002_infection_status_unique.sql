@@ -0,0 +1,9 @@
+-- (date, prefecture)を自然キーとし、再実行時は登録ではなく更新する
+-- 既存の重複行は最初に登録された行（idが最小の行）を残す
+-- INSERT IGNOREは先に挿入した行を残すため、id順に挿入する
+CREATE TABLE infection_status_dedup LIKE infection_status;
+ALTER TABLE infection_status_dedup ADD UNIQUE KEY uk_infection_status_date_prefecture (date, prefecture);
+INSERT IGNORE INTO infection_status_dedup SELECT * FROM infection_status ORDER BY id;
+RENAME TABLE infection_status TO infection_status_duplicated, infection_status_dedup TO infection_status;
+-- 確認後に削除する
+-- DROP TABLE infection_status_duplicated;
@@ -0,0 +1,16 @@
+-- 取得した値の履歴（値を取得した時刻 recorded_at ごとに保持する）
+-- /infectionStatus/{type}?asOf= で指定時刻時点の値を参照する
+CREATE TABLE IF NOT EXISTS infection_status_version (
+    id                            BIGINT      NOT NULL AUTO_INCREMENT,
+    date                          DATE        NOT NULL,
+    prefecture                    VARCHAR(16) NOT NULL,
+    infection_number_daily        INT         NOT NULL,
+    infection_number_cumulatively INT         NOT NULL,
+    recorded_at                   DATETIME(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_infection_status_version_key (date, prefecture, recorded_at)
+);
+
+-- 既存の値は取得時刻が不明のため移行時刻で登録する
+INSERT INTO infection_status_version (date, prefecture, infection_number_daily, infection_number_cumulatively, recorded_at)
+SELECT date, prefecture, infection_number_daily, infection_number_cumulatively, NOW(6) FROM infection_status;
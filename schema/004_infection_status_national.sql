@@ -0,0 +1,14 @@
+-- 全国の行（prefecture = '全国'）は集計に含まれる都道府県数を prefecture_count に保持する
+-- 都道府県別の行は NULL
+ALTER TABLE infection_status ADD COLUMN prefecture_count TINYINT NULL;
+ALTER TABLE infection_status_version ADD COLUMN prefecture_count TINYINT NULL AFTER infection_number_cumulatively;
+
+-- 登録済みの日付の全国の行を作成する
+INSERT INTO infection_status (date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count)
+SELECT date, '全国', SUM(infection_number_daily), SUM(infection_number_cumulatively), COUNT(*)
+FROM infection_status WHERE prefecture <> '全国' GROUP BY date
+ON DUPLICATE KEY UPDATE infection_number_daily = VALUES(infection_number_daily), infection_number_cumulatively = VALUES(infection_number_cumulatively), prefecture_count = VALUES(prefecture_count);
+
+INSERT INTO infection_status_version (date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count, recorded_at)
+SELECT date, prefecture, infection_number_daily, infection_number_cumulatively, prefecture_count, NOW(6)
+FROM infection_status WHERE prefecture = '全国';
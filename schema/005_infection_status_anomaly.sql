@@ -0,0 +1,14 @@
+-- 登録時に検出した日次感染者数の異常値（reason: negative | outlier）
+-- infection_number_daily は検出時の値（asOf で別の値を参照する場合は対象外とする）
+-- expected は直近の履歴の中央値（smooth の置き換え用）。履歴が足りない場合は NULL
+-- 登録済みの値は infection-status-register の from/to で再登録すると検出される
+CREATE TABLE IF NOT EXISTS infection_status_anomaly (
+    date                   DATE        NOT NULL,
+    prefecture             VARCHAR(16) NOT NULL,
+    reason                 VARCHAR(16) NOT NULL,
+    infection_number_daily INT         NOT NULL,
+    expected               DOUBLE      NULL,
+    score                  DOUBLE      NULL,
+    detected_at            DATETIME(6) NOT NULL,
+    PRIMARY KEY (date, prefecture)
+);